@@ -1,23 +1,74 @@
 package api
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
+	"github.com/deepersensor/documcp/collection"
 	"github.com/deepersensor/documcp/docstore"
 	"github.com/deepersensor/documcp/index"
+	"github.com/deepersensor/documcp/scheduler"
 )
 
 var (
-	docStore map[string]*docstore.Document
-	idx      *index.InvertedIndex
+	collections       *collection.Manager
+	defaultCollection = collection.DefaultName
+	sched             *scheduler.Scheduler
 )
 
-func SetGlobalStores(ds map[string]*docstore.Document, i *index.InvertedIndex) {
-	docStore = ds
-	idx = i
+// SetCollections sets the collection manager used by the REST and MCP
+// handlers, and the collection used when a request does not name one.
+func SetCollections(m *collection.Manager, defaultName string) {
+	collections = m
+	defaultCollection = defaultName
+}
+
+// getCollection returns the named collection, or the default one if name is empty.
+func getCollection(name string) (*collection.Collection, error) {
+	if name == "" {
+		name = defaultCollection
+	}
+	return collections.Get(name)
+}
+
+// collectionFromRequest resolves the "collection" query parameter, writing an
+// HTTP error and returning nil on failure.
+func collectionFromRequest(w http.ResponseWriter, r *http.Request) *collection.Collection {
+	c, err := getCollection(r.URL.Query().Get("collection"))
+	if errors.Is(err, collection.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	return c
+}
+
+// searchErrorStatus returns the HTTP status for an error from Search or
+// PackContext: the client's fault for a malformed query or invalid options,
+// a bad gateway when the embedder fails, and a server error otherwise.
+func searchErrorStatus(err error) int {
+	var serr *index.SyntaxError
+	switch {
+	case errors.As(err, &serr), errors.Is(err, collection.ErrInvalidOption):
+		return http.StatusBadRequest
+	case errors.Is(err, collection.ErrEmbedder):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// SetScheduler sets the scheduler used to run crawls requested over MCP.
+func SetScheduler(s *scheduler.Scheduler) {
+	sched = s
 }
 
 // StartServer starts the API server on the given address.
@@ -25,6 +76,8 @@ func StartServer(addr string) error {
 	http.HandleFunc("/health", healthHandler)
 	http.HandleFunc("/mcp", mcpHandler)
 	http.HandleFunc("/query", queryHandler)
+	http.HandleFunc("/suggest", suggestHandler)
+	http.HandleFunc("/context", contextHandler)
 	http.HandleFunc("/document/", documentHandler)
 
 	fmt.Printf("API server listening on %s\n", addr)
@@ -37,51 +90,268 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-// mcpHandler is a placeholder for Model Context Protocol integration.
-func mcpHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotImplemented)
-	json.NewEncoder(w).Encode(map[string]string{
-		"error": "MCP endpoint not implemented yet",
-	})
-}
+// maxQueryLimit is the largest page of results /query returns.
+const maxQueryLimit = 100
 
+// queryHandler searches a collection and returns one page of results. limit,
+// offset and sort select the page; cursor, taken from next_cursor of the
+// previous response, may be given instead of offset. mode selects lexical,
+// vector or hybrid search.
 func queryHandler(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query().Get("q")
+	params := r.URL.Query()
+	q := params.Get("q")
 	if q == "" {
 		http.Error(w, "Missing query parameter 'q'", http.StatusBadRequest)
 		return
 	}
-	results := idx.Search(q)
+	search := collection.SearchOptions{Limit: collection.DefaultLimit, Sort: params.Get("sort"), Mode: params.Get("mode")}
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		search.Limit = min(n, maxQueryLimit)
+	}
+	if s := params.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		search.Offset = n
+	}
+	if s := params.Get("cursor"); s != "" {
+		if params.Has("offset") {
+			http.Error(w, "Use either offset or cursor, not both", http.StatusBadRequest)
+			return
+		}
+		n, ok := decodeCursor(s)
+		if !ok {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		search.Offset = n
+	}
+	full := false
+	if s := params.Get("full_text"); s != "" {
+		var err error
+		if full, err = strconv.ParseBool(s); err != nil {
+			http.Error(w, "Invalid full_text", http.StatusBadRequest)
+			return
+		}
+	}
+	opts, ok := snippetOptions(params)
+	if !ok {
+		http.Error(w, "Invalid snippet_length", http.StatusBadRequest)
+		return
+	}
+	c := collectionFromRequest(w, r)
+	if c == nil {
+		return
+	}
+	hits, total, err := c.Search(r.Context(), q, search)
+	if err != nil {
+		http.Error(w, err.Error(), searchErrorStatus(err))
+		return
+	}
+	hl := c.Index.Highlighter(q, opts)
+	type apiSection struct {
+		ID   string   `json:"id"`
+		URL  string   `json:"url"`
+		Path []string `json:"path,omitempty"`
+		Text string   `json:"text,omitempty"`
+	}
 	type apiResult struct {
-		ID           string   `json:"id"`
-		URL          string   `json:"url"`
-		Text         string   `json:"text"`
-		Headings     []string `json:"headings,omitempty"`
-		CodeSnippets []string `json:"code_snippets,omitempty"`
-	}
-	var out []apiResult
-	for _, doc := range results {
-		d := docStore[doc.ID]
-		out = append(out, apiResult{
+		ID           string      `json:"id"`
+		URL          string      `json:"url"`
+		Title        string      `json:"title,omitempty"`
+		Score        float64     `json:"score"`
+		Section      *apiSection `json:"section,omitempty"`
+		Snippet      string      `json:"snippet"`
+		Text         string      `json:"text,omitempty"`
+		Headings     []string    `json:"headings,omitempty"`
+		CodeSnippets []string    `json:"code_snippets,omitempty"`
+	}
+	type apiResponse struct {
+		Total       int         `json:"total"`
+		Offset      int         `json:"offset"`
+		Limit       int         `json:"limit"`
+		NextCursor  string      `json:"next_cursor,omitempty"`
+		Results     []apiResult `json:"results"`
+		Suggestions []string    `json:"suggestions,omitempty"`
+	}
+	out := apiResponse{
+		Total:       total,
+		Offset:      search.Offset,
+		Limit:       search.Limit,
+		Results:     []apiResult{},
+		Suggestions: c.Suggest(q, total),
+	}
+	if next := search.Offset + len(hits); len(hits) > 0 && next < total {
+		out.NextCursor = encodeCursor(next)
+	}
+	for _, h := range hits {
+		d := h.Doc
+		// The snippet comes from the matching section when there is one.
+		passage := d.Text
+		if h.Section != nil {
+			passage = h.Section.Text
+		}
+		res := apiResult{
 			ID:           d.ID,
 			URL:          d.URL,
-			Text:         d.Text,
+			Title:        d.Title,
+			Score:        h.Score,
+			Snippet:      hl.Snippet(passage),
 			Headings:     d.Headings,
 			CodeSnippets: d.CodeSnippets,
-		})
+		}
+		if full {
+			res.Text = d.Text
+		}
+		if sec := h.Section; sec != nil {
+			res.Section = &apiSection{ID: sec.ID, URL: sec.URL, Path: sec.Path}
+			if full {
+				res.Section.Text = sec.Text
+			}
+		}
+		out.Results = append(out.Results, res)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(out)
 }
 
+// encodeCursor returns the opaque pagination cursor for a result offset.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the offset encoded by encodeCursor.
+func decodeCursor(cursor string) (int, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(b))
+	return n, err == nil && n >= 0
+}
+
+// snippetOptions reads the highlight_pre, highlight_post and snippet_length
+// query parameters, reporting false if snippet_length is invalid.
+func snippetOptions(params url.Values) (index.SnippetOptions, bool) {
+	opts := index.SnippetOptions{Pre: index.DefaultHighlightPre, Post: index.DefaultHighlightPost}
+	if params.Has("highlight_pre") {
+		opts.Pre = params.Get("highlight_pre")
+	}
+	if params.Has("highlight_post") {
+		opts.Post = params.Get("highlight_post")
+	}
+	if s := params.Get("snippet_length"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return opts, false
+		}
+		opts.Length = n
+	}
+	return opts, true
+}
+
+// suggestHandler completes a partially typed query for search-as-you-type:
+// the words that may finish its last word and the pages whose titles match.
+func suggestHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if strings.TrimSpace(q) == "" {
+		http.Error(w, "Missing query parameter 'q'", http.StatusBadRequest)
+		return
+	}
+	limit := defaultSearchLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = clampLimit(n)
+	}
+	c := collectionFromRequest(w, r)
+	if c == nil {
+		return
+	}
+	type apiTitle struct {
+		ID    string `json:"id"`
+		URL   string `json:"url"`
+		Title string `json:"title"`
+	}
+	type apiResponse struct {
+		Completions []string   `json:"completions"`
+		Terms       []string   `json:"terms"`
+		Titles      []apiTitle `json:"titles"`
+	}
+	words, titles := c.Index.Complete(q, limit)
+	out := apiResponse{
+		Completions: append([]string{}, completedQueries(q, words)...),
+		Terms:       append([]string{}, words...),
+		Titles:      []apiTitle{},
+	}
+	for _, t := range titles {
+		out.Titles = append(out.Titles, apiTitle{ID: t.ID, URL: t.URL, Title: t.Title})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// contextHandler packs the sections best matching a query into a token
+// budget, for passing straight to a language model. Besides the chunks, the
+// response carries them rendered as one markdown text.
+func contextHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := params.Get("q")
+	if strings.TrimSpace(q) == "" {
+		http.Error(w, "Missing query parameter 'q'", http.StatusBadRequest)
+		return
+	}
+	budget := defaultContextTokens
+	if s := params.Get("budget"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid budget", http.StatusBadRequest)
+			return
+		}
+		budget = clampBudget(n)
+	}
+	c := collectionFromRequest(w, r)
+	if c == nil {
+		return
+	}
+	source := params.Get("source")
+	pack, err := c.PackContext(r.Context(), q, collection.PackOptions{
+		Budget: budget,
+		Mode:   params.Get("mode"),
+		Filter: func(page *docstore.Document) bool { return matchesSource(page.URL, source) },
+	})
+	if err != nil {
+		http.Error(w, err.Error(), searchErrorStatus(err))
+		return
+	}
+	out := contextResponse(pack)
+	out["query"] = q
+	out["context"] = pack.String()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
 func documentHandler(w http.ResponseWriter, r *http.Request) {
 	id := strings.TrimPrefix(r.URL.Path, "/document/")
 	if id == "" {
 		http.Error(w, "Missing document ID", http.StatusBadRequest)
 		return
 	}
-	d, ok := docStore[id]
+	c := collectionFromRequest(w, r)
+	if c == nil {
+		return
+	}
+	d, ok := c.Docs.Get(id)
 	if !ok {
 		http.Error(w, "Document not found", http.StatusNotFound)
 		return
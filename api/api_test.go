@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/deepersensor/documcp/collection"
+	"github.com/deepersensor/documcp/crawler"
+)
+
+// failingEmbedder fails every request, like an unreachable embeddings API.
+type failingEmbedder struct{}
+
+func (failingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (failingEmbedder) Name() string { return "failing" }
+
+// queryResponse is the part of a /query response the tests look at.
+type queryResponse struct {
+	Total      int    `json:"total"`
+	Offset     int    `json:"offset"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor"`
+	Results    []struct {
+		ID      string `json:"id"`
+		Snippet string `json:"snippet"`
+		Section *struct {
+			Path []string `json:"path"`
+		} `json:"section"`
+	} `json:"results"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// getQuery runs a /query request and decodes a successful response.
+func getQuery(t *testing.T, target string) queryResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	queryHandler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", target, rec.Code, rec.Body)
+	}
+	var resp queryResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+	return resp
+}
+
+func TestQueryPagination(t *testing.T) {
+	c := setupCollections(t, nil)
+	var guides []crawler.CrawlResult
+	for i := range 5 {
+		guides = append(guides, crawler.CrawlResult{
+			URL:   fmt.Sprintf("http://example.com/guide/%d", i),
+			Title: fmt.Sprintf("Guide %d", i),
+			Text:  "A guide to deployment.",
+		})
+	}
+	c.AddResults(guides)
+
+	seen := make(map[string]bool)
+	target := "/query?q=deployment&limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("cursors do not end")
+		}
+		resp := getQuery(t, target)
+		if resp.Total != 5 || resp.Limit != 2 {
+			t.Errorf("GET %s: total %d, limit %d, want 5 and 2", target, resp.Total, resp.Limit)
+		}
+		for _, r := range resp.Results {
+			if seen[r.ID] {
+				t.Errorf("GET %s: %s seen on an earlier page", target, r.ID)
+			}
+			seen[r.ID] = true
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		target = "/query?q=deployment&limit=2&cursor=" + resp.NextCursor
+	}
+	if len(seen) != 5 {
+		t.Errorf("paging returned %d results, want 5", len(seen))
+	}
+
+	tests := []struct {
+		target string
+		offset int
+		limit  int
+		n      int
+	}{
+		{"/query?q=deployment", 0, collection.DefaultLimit, 5},
+		{"/query?q=deployment&offset=4", 4, collection.DefaultLimit, 1},
+		{"/query?q=deployment&offset=9", 9, collection.DefaultLimit, 0},
+		{"/query?q=deployment&limit=1000", 0, maxQueryLimit, 5},
+		{"/query?q=deployment&sort=title&limit=1", 0, 1, 1},
+	}
+	for _, tt := range tests {
+		resp := getQuery(t, tt.target)
+		if resp.Offset != tt.offset || resp.Limit != tt.limit || len(resp.Results) != tt.n {
+			t.Errorf("GET %s: offset %d, limit %d, %d results; want %d, %d, %d",
+				tt.target, resp.Offset, resp.Limit, len(resp.Results), tt.offset, tt.limit, tt.n)
+		}
+	}
+}
+
+func TestQueryInvalidParameters(t *testing.T) {
+	setupCollections(t, nil)
+	for _, target := range []string{
+		"/query",
+		"/query?q=task&limit=0",
+		"/query?q=task&limit=ten",
+		"/query?q=task&offset=-1",
+		"/query?q=task&offset=1&cursor=" + encodeCursor(2),
+		"/query?q=task&cursor=%21%21",
+		"/query?q=task&full_text=maybe",
+		"/query?q=task&snippet_length=0",
+	} {
+		rec := httptest.NewRecorder()
+		queryHandler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status %d, want %d", target, rec.Code, http.StatusBadRequest)
+		}
+	}
+	rec := httptest.NewRecorder()
+	queryHandler(rec, httptest.NewRequest(http.MethodGet, "/query?q=task&collection=missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown collection: status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestQuerySections(t *testing.T) {
+	setupCollections(t, nil)
+	resp := getQuery(t, "/query?q=abort")
+	if len(resp.Results) != 1 || resp.Results[0].Section == nil {
+		t.Fatalf("GET /query?q=abort = %+v, want the jobs page with its section", resp.Results)
+	}
+	if got := strings.Join(resp.Results[0].Section.Path, " > "); got != "Task Runner > Cancel a task" {
+		t.Errorf("section path %q, want %q", got, "Task Runner > Cancel a task")
+	}
+	if got := resp.Results[0].Snippet; !strings.Contains(got, "**abort**") {
+		t.Errorf("snippet %q does not highlight the match", got)
+	}
+	if resp := getQuery(t, "/query?q=cancle"); len(resp.Suggestions) == 0 || resp.Suggestions[0] != "cancel" {
+		t.Errorf("suggestions %q, want cancel", resp.Suggestions)
+	}
+}
+
+func TestSearchErrorStatus(t *testing.T) {
+	setupCollections(t, failingEmbedder{})
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/query?q=task", http.StatusOK},
+		{"/query?q=%22task", http.StatusBadRequest},
+		{"/query?q=task&mode=semantic", http.StatusBadRequest},
+		{"/query?q=task&sort=date", http.StatusBadRequest},
+		{"/query?q=task&mode=vector", http.StatusBadGateway},
+		{"/query?q=task&mode=hybrid", http.StatusBadGateway},
+		{"/context?q=task", http.StatusOK},
+		{"/context?q=task%20AND", http.StatusBadRequest},
+		{"/context?q=task&mode=semantic", http.StatusBadRequest},
+		{"/context?q=task&mode=vector", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		switch req.URL.Path {
+		case "/query":
+			queryHandler(rec, req)
+		case "/context":
+			contextHandler(rec, req)
+		}
+		if rec.Code != tt.want {
+			t.Errorf("GET %s: status %d, want %d (%s)", tt.target, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
@@ -1,3 +1,493 @@
 package api
 
-// TODO: Implement Model Context Protocol (MCP) integration here.
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// MCP protocol constants.
+const (
+	jsonRPCVersion     = "2.0"
+	mcpProtocolVersion = "2025-06-18"
+	mcpServerName      = "documcp"
+	mcpServerVersion   = "0.1.0"
+)
+
+// supportedProtocolVersions lists MCP revisions this server can speak, newest first.
+var supportedProtocolVersions = []string{mcpProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// JSON-RPC 2.0 error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// rpcMessage is an incoming JSON-RPC 2.0 request or notification.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// isNotification reports whether the message expects no response.
+func (m *rpcMessage) isNotification() bool {
+	return len(m.ID) == 0 || string(m.ID) == "null"
+}
+
+// rpcResponse is an outgoing JSON-RPC 2.0 response.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcNotification is an outgoing JSON-RPC 2.0 notification.
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// rpcError is a JSON-RPC 2.0 error object.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// mcpContent is a single MCP content block.
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// mcpToolResult is the result of a tools/call request.
+type mcpToolResult struct {
+	Content           []mcpContent `json:"content"`
+	StructuredContent any          `json:"structuredContent,omitempty"`
+	IsError           bool         `json:"isError,omitempty"`
+}
+
+// mcpTool describes a tool exposed to MCP clients.
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+	handler     func(ctx context.Context, args json.RawMessage) (*mcpToolResult, error)
+}
+
+// MCPServer implements the Model Context Protocol on top of the global stores.
+// It is transport agnostic: callers feed it raw JSON-RPC messages and
+// receive server-initiated messages through the send callback.
+type MCPServer struct {
+	mu          sync.Mutex
+	initialized bool
+	closed      bool
+	tools       []mcpTool
+	send        func(msg []byte)
+	inflight    map[string]context.CancelFunc
+}
+
+// NewMCPServer creates a new MCPServer with the search and crawl tools. send is
+// called with every server-initiated message that is not tied to a request;
+// it may be nil if the transport cannot deliver them.
+func NewMCPServer(send func(msg []byte)) *MCPServer {
+	return &MCPServer{
+		tools:    append(defaultTools(), crawlTools()...),
+		send:     send,
+		inflight: make(map[string]context.CancelFunc),
+	}
+}
+
+// sinkKey is the context key for a per-request message sink.
+type sinkKey struct{}
+
+// withSink returns a context whose notifications are delivered to sink
+// instead of the server-wide send callback, e.g. an SSE response stream.
+func withSink(ctx context.Context, sink func(msg []byte)) context.Context {
+	return context.WithValue(ctx, sinkKey{}, sink)
+}
+
+// progressKey is the context key for a request's progress reporter.
+type progressKey struct{}
+
+// reportProgress sends a notifications/progress message for the request in
+// ctx if the client asked for progress updates; otherwise it does nothing.
+func reportProgress(ctx context.Context, progress, total float64, message string) {
+	if report, ok := ctx.Value(progressKey{}).(func(float64, float64, string)); ok {
+		report(progress, total, message)
+	}
+}
+
+// notify sends a notification to the client, preferring the sink of the
+// request being handled in ctx.
+func (s *MCPServer) notify(ctx context.Context, method string, params any) {
+	b, err := json.Marshal(rpcNotification{JSONRPC: jsonRPCVersion, Method: method, Params: params})
+	if err != nil {
+		return
+	}
+	if sink, ok := ctx.Value(sinkKey{}).(func([]byte)); ok && sink != nil {
+		sink(b)
+		return
+	}
+	if s.send != nil {
+		s.send(b)
+	}
+}
+
+// isInitialized reports whether the initialize handshake has completed.
+func (s *MCPServer) isInitialized() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.initialized
+}
+
+// Closed reports whether the client has requested a shutdown.
+func (s *MCPServer) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// HandleMessage processes one raw JSON-RPC message, or a batch of them, and
+// returns the encoded response, or nil if there is nothing to answer.
+func (s *MCPServer) HandleMessage(ctx context.Context, raw []byte) []byte {
+	msgs, batch, err := decodeMessages(raw)
+	if err != nil {
+		return encodeResponse(errorResponse(nil, codeParseError, "parse error"))
+	}
+	if batch {
+		return encodeBatch(s.handleBatch(ctx, msgs))
+	}
+	resp := s.handle(ctx, &msgs[0])
+	if resp == nil {
+		return nil
+	}
+	return encodeResponse(resp)
+}
+
+// decodeMessages decodes a single JSON-RPC message, or a batch of them as
+// protocol revision 2025-03-26 allows, and reports whether it was a batch.
+// Batch elements that are not objects decode as invalid messages.
+func decodeMessages(raw []byte) (msgs []rpcMessage, batch bool, err error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '[' {
+		var msg rpcMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, false, err
+		}
+		return []rpcMessage{msg}, false, nil
+	}
+	var elems []json.RawMessage
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		return nil, true, err
+	}
+	msgs = make([]rpcMessage, len(elems))
+	for i, e := range elems {
+		if json.Unmarshal(e, &msgs[i]) != nil {
+			msgs[i] = rpcMessage{}
+		}
+	}
+	return msgs, true, nil
+}
+
+// handleBatch handles the messages of a batch in order and returns the
+// responses to its requests. An empty batch is an invalid request, and
+// initialize may not be batched.
+func (s *MCPServer) handleBatch(ctx context.Context, msgs []rpcMessage) []*rpcResponse {
+	if len(msgs) == 0 {
+		return []*rpcResponse{errorResponse(nil, codeInvalidRequest, "empty batch")}
+	}
+	var resps []*rpcResponse
+	for i := range msgs {
+		msg := &msgs[i]
+		switch {
+		case msg.JSONRPC != jsonRPCVersion:
+			// Unlike a lone message, a malformed batch element is answered
+			// even without an ID.
+			resps = append(resps, errorResponse(msg.ID, codeInvalidRequest, "invalid request"))
+		case msg.Method == "initialize":
+			resps = append(resps, errorResponse(msg.ID, codeInvalidRequest, "initialize must not be batched"))
+		default:
+			if resp := s.handle(ctx, msg); resp != nil {
+				resps = append(resps, resp)
+			}
+		}
+	}
+	return resps
+}
+
+// handle dispatches a decoded message to its method handler.
+func (s *MCPServer) handle(ctx context.Context, msg *rpcMessage) *rpcResponse {
+	if msg.JSONRPC != jsonRPCVersion || msg.Method == "" {
+		if msg.isNotification() {
+			// Responses to server requests and malformed notifications are ignored.
+			return nil
+		}
+		return errorResponse(msg.ID, codeInvalidRequest, "invalid request")
+	}
+	if msg.isNotification() {
+		s.handleNotification(msg)
+		return nil
+	}
+
+	if !s.isInitialized() && msg.Method != "initialize" && msg.Method != "ping" {
+		return errorResponse(msg.ID, codeInvalidRequest, "server not initialized")
+	}
+
+	// Track the request so notifications/cancelled can abort it.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	key := string(msg.ID)
+	s.mu.Lock()
+	s.inflight[key] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.inflight, key)
+		s.mu.Unlock()
+	}()
+
+	var (
+		result any
+		err    error
+	)
+	switch msg.Method {
+	case "initialize":
+		result, err = s.initialize(msg.Params)
+	case "ping":
+		result = struct{}{}
+	case "shutdown":
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		result = struct{}{}
+	case "tools/list":
+		result = map[string]any{"tools": s.tools}
+	case "tools/call":
+		result, err = s.callTool(ctx, msg.Params)
+	case "resources/list":
+		result, err = listResources(msg.Params)
+	case "resources/read":
+		result, err = readResource(msg.Params)
+	case "resources/templates/list":
+		result = map[string]any{"resourceTemplates": resourceTemplates}
+	case "prompts/list":
+		result = map[string]any{"prompts": prompts}
+	case "prompts/get":
+		result, err = getPrompt(msg.Params)
+	case "completion/complete":
+		result, err = complete(msg.Params)
+	default:
+		return errorResponse(msg.ID, codeMethodNotFound, "method not found: "+msg.Method)
+	}
+	if err != nil {
+		var rerr *rpcError
+		if errors.As(err, &rerr) {
+			return errorResponse(msg.ID, rerr.Code, rerr.Message)
+		}
+		return errorResponse(msg.ID, codeInternalError, err.Error())
+	}
+	return &rpcResponse{JSONRPC: jsonRPCVersion, ID: msg.ID, Result: result}
+}
+
+// handleNotification processes client notifications.
+func (s *MCPServer) handleNotification(msg *rpcMessage) {
+	switch msg.Method {
+	case "notifications/initialized":
+		s.mu.Lock()
+		s.initialized = true
+		s.mu.Unlock()
+	case "notifications/cancelled":
+		var p struct {
+			RequestID json.RawMessage `json:"requestId"`
+		}
+		if json.Unmarshal(msg.Params, &p) != nil {
+			return
+		}
+		s.mu.Lock()
+		cancel, ok := s.inflight[string(p.RequestID)]
+		s.mu.Unlock()
+		if ok {
+			cancel()
+		}
+	}
+}
+
+// initialize negotiates the protocol version and advertises capabilities.
+func (s *MCPServer) initialize(params json.RawMessage) (any, error) {
+	var p struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: "invalid initialize params"}
+		}
+	}
+	version := mcpProtocolVersion
+	for _, v := range supportedProtocolVersions {
+		if v == p.ProtocolVersion {
+			version = v
+			break
+		}
+	}
+	// Some clients never send notifications/initialized; accept requests
+	// as soon as the handshake response has been produced.
+	s.mu.Lock()
+	s.initialized = true
+	s.mu.Unlock()
+	return map[string]any{
+		"protocolVersion": version,
+		"capabilities": map[string]any{
+			"tools":       map[string]any{"listChanged": false},
+			"resources":   map[string]any{"subscribe": false, "listChanged": true},
+			"prompts":     map[string]any{"listChanged": false},
+			"completions": map[string]any{},
+		},
+		"serverInfo": map[string]string{
+			"name":    mcpServerName,
+			"version": mcpServerVersion,
+		},
+		"instructions": "Search crawled documentation with search_docs, then read pages with get_document or a single section with get_section. list_sources shows which sites are indexed; start_crawl indexes a new site.",
+	}, nil
+}
+
+// callTool runs the named tool with the given arguments.
+func (s *MCPServer) callTool(ctx context.Context, params json.RawMessage) (any, error) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+		Meta      struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "invalid tools/call params"}
+	}
+	if token := p.Meta.ProgressToken; len(token) > 0 {
+		ctx = context.WithValue(ctx, progressKey{}, func(progress, total float64, message string) {
+			params := map[string]any{"progressToken": token, "progress": progress}
+			if total > 0 {
+				params["total"] = total
+			}
+			if message != "" {
+				params["message"] = message
+			}
+			s.notify(ctx, "notifications/progress", params)
+		})
+	}
+	for _, t := range s.tools {
+		if t.Name != p.Name {
+			continue
+		}
+		args := p.Arguments
+		if len(args) == 0 {
+			args = json.RawMessage("{}")
+		}
+		res, err := t.handler(ctx, args)
+		if err != nil {
+			// Tool failures are reported in the result so the model can see them.
+			return toolError(err.Error()), nil
+		}
+		return res, nil
+	}
+	return nil, &rpcError{Code: codeInvalidParams, Message: "unknown tool: " + p.Name}
+}
+
+// ServeStdio runs an MCP server over newline-delimited JSON on in/out until
+// EOF or a shutdown request. Once initialized, requests are handled
+// concurrently so that a long-running tool call does not block pings or
+// cancellations; before that they are handled in order, so none can race
+// ahead of initialize.
+func ServeStdio(in io.Reader, out io.Writer) error {
+	var wmu sync.Mutex
+	w := bufio.NewWriter(out)
+	writeLine := func(msg []byte) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+		w.Write(msg)
+		w.WriteByte('\n')
+		return w.Flush()
+	}
+	s := NewMCPServer(func(msg []byte) { writeLine(msg) })
+	registerServer(s)
+	defer unregisterServer(s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	r := bufio.NewReader(in)
+	for {
+		line, err := r.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var msg rpcMessage
+			if s.isInitialized() && json.Unmarshal(line, &msg) == nil && !msg.isNotification() && msg.Method != "initialize" && msg.Method != "shutdown" {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					writeLine(s.HandleMessage(ctx, line))
+				}()
+			} else if resp := s.HandleMessage(ctx, line); resp != nil {
+				if err := writeLine(resp); err != nil {
+					return err
+				}
+			}
+			if s.Closed() {
+				return nil
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func errorResponse(id json.RawMessage, code int, msg string) *rpcResponse {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: jsonRPCVersion, ID: id, Error: &rpcError{Code: code, Message: msg}}
+}
+
+// encodeBatch encodes the responses to a batch as an array, or returns nil
+// if the batch held only notifications.
+func encodeBatch(resps []*rpcResponse) []byte {
+	if len(resps) == 0 {
+		return nil
+	}
+	out := make([]json.RawMessage, len(resps))
+	for i, resp := range resps {
+		out[i] = encodeResponse(resp)
+	}
+	b, _ := json.Marshal(out)
+	return b
+}
+
+func encodeResponse(resp *rpcResponse) []byte {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		b, _ = json.Marshal(errorResponse(resp.ID, codeInternalError, err.Error()))
+	}
+	return b
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxCompletionValues is the most values a completion/complete result may
+// carry.
+const maxCompletionValues = 100
+
+// mcpPrompt describes a prompt in prompts/list.
+type mcpPrompt struct {
+	Name        string              `json:"name"`
+	Title       string              `json:"title,omitempty"`
+	Description string              `json:"description"`
+	Arguments   []mcpPromptArgument `json:"arguments"`
+}
+
+// mcpPromptArgument is an argument a prompt accepts.
+type mcpPromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// prompts are offered so that clients can complete a search query as the
+// user types it; completion/complete only applies to prompt and resource
+// template arguments.
+var prompts = []mcpPrompt{
+	{
+		Name:        "search",
+		Title:       "Search documentation",
+		Description: "Search the crawled documentation and answer from the pages found",
+		Arguments: []mcpPromptArgument{
+			{Name: "query", Description: "What to search for", Required: true},
+			{Name: "collection", Description: "Collection to search; defaults to the server's default collection"},
+		},
+	},
+}
+
+// getPrompt renders the search prompt.
+func getPrompt(params json.RawMessage) (any, error) {
+	var p struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "invalid prompts/get params"}
+	}
+	if p.Name != "search" {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "unknown prompt: " + p.Name}
+	}
+	query := strings.TrimSpace(p.Arguments["query"])
+	if query == "" {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "missing required argument: query"}
+	}
+	text := fmt.Sprintf("Search the documentation for %q with the search_docs tool", query)
+	if c := p.Arguments["collection"]; c != "" {
+		text += fmt.Sprintf(" in the %q collection", c)
+	}
+	text += ", read the most relevant pages, and answer using what they say. Cite the URLs you used."
+	return map[string]any{
+		"description": "Search documentation for " + query,
+		"messages": []map[string]any{{
+			"role":    "user",
+			"content": map[string]string{"type": "text", "text": text},
+		}},
+	}, nil
+}
+
+// complete answers completion/complete: search queries of the search
+// prompt complete to indexed words and page titles, collection arguments to
+// collection names and document-by-url URLs to crawled page URLs.
+func complete(params json.RawMessage) (any, error) {
+	var p struct {
+		Ref struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+			URI  string `json:"uri"`
+		} `json:"ref"`
+		Argument struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"argument"`
+		Context struct {
+			Arguments map[string]string `json:"arguments"`
+		} `json:"context"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "invalid completion/complete params"}
+	}
+	var values []string
+	switch {
+	case p.Ref.Type == "ref/prompt" && p.Ref.Name == "search" && p.Argument.Name == "query":
+		c, err := getCollection(p.Context.Arguments["collection"])
+		if err != nil {
+			break
+		}
+		words, titles := c.Index.Complete(p.Argument.Value, maxCompletionValues)
+		values = completedQueries(p.Argument.Value, words)
+		for _, t := range titles {
+			values = append(values, t.Title)
+		}
+	case p.Argument.Name == "collection":
+		names, err := collections.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if strings.HasPrefix(name, p.Argument.Value) {
+				values = append(values, name)
+			}
+		}
+	case p.Ref.Type == "ref/resource" && strings.HasPrefix(p.Ref.URI, resourceURLPrefix) && p.Argument.Name == "url":
+		c, err := getCollection(p.Context.Arguments["collection"])
+		if err != nil {
+			break
+		}
+		prefix, err := url.PathUnescape(p.Argument.Value)
+		if err != nil {
+			prefix = p.Argument.Value
+		}
+		for _, d := range c.Docs.Pages() {
+			if strings.HasPrefix(d.URL, prefix) {
+				values = append(values, d.URL)
+			}
+		}
+		sort.Strings(values)
+	}
+	values = dedupe(values)
+	total := len(values)
+	if len(values) > maxCompletionValues {
+		values = values[:maxCompletionValues]
+	}
+	return map[string]any{
+		"completion": map[string]any{
+			"values":  append([]string{}, values...),
+			"total":   total,
+			"hasMore": total > len(values),
+		},
+	}, nil
+}
+
+// completedQueries returns text with its last word replaced by each of
+// words.
+func completedQueries(text string, words []string) []string {
+	head := strings.TrimRightFunc(text, func(r rune) bool { return !unicode.IsSpace(r) })
+	queries := make([]string, len(words))
+	for i, w := range words {
+		queries[i] = head + w
+	}
+	return queries
+}
+
+// dedupe removes repeated values, keeping the first of each.
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := values[:0]
+	for _, v := range values {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	setupCollections(t, nil)
+	const searchRef = `{"type":"ref/prompt","name":"search"}`
+	const urlRef = `{"type":"ref/resource","uri":"documcp://url/{url}{?collection}"}`
+	tests := []struct {
+		params string
+		want   string // completion values joined by "|"
+	}{
+		{`{"ref":` + searchRef + `,"argument":{"name":"query","value":"inst"}}`, "install|Install"},
+		{`{"ref":` + searchRef + `,"argument":{"name":"query","value":"how to canc"}}`, "how to cancel"},
+		{`{"ref":` + searchRef + `,"argument":{"name":"query","value":"task r"}}`, "task run|task runner|Task Runner"},
+		{`{"ref":` + searchRef + `,"argument":{"name":"query","value":"inst"},"context":{"arguments":{"collection":"nosuch"}}}`, ""},
+		{`{"ref":` + searchRef + `,"argument":{"name":"collection","value":"def"}}`, "default"},
+		{`{"ref":` + searchRef + `,"argument":{"name":"collection","value":"x"}}`, ""},
+		{`{"ref":` + urlRef + `,"argument":{"name":"url","value":"http://example.com/"}}`, "http://example.com/install|http://example.com/jobs"},
+		{`{"ref":` + urlRef + `,"argument":{"name":"url","value":"http%3A%2F%2Fexample.com%2Fj"}}`, "http://example.com/jobs"},
+		{`{"ref":{"type":"ref/prompt","name":"other"},"argument":{"name":"query","value":"inst"}}`, ""},
+	}
+	for _, tt := range tests {
+		raw, errMsg := callMCP(t, "completion/complete", tt.params)
+		if errMsg != "" {
+			t.Errorf("complete %s: %s", tt.params, errMsg)
+			continue
+		}
+		var res struct {
+			Completion struct {
+				Values  []string `json:"values"`
+				Total   int      `json:"total"`
+				HasMore bool     `json:"hasMore"`
+			} `json:"completion"`
+		}
+		if err := json.Unmarshal(raw, &res); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(res.Completion.Values, "|"); got != tt.want {
+			t.Errorf("complete %s = %q, want %q", tt.params, got, tt.want)
+		}
+		if res.Completion.Total != len(res.Completion.Values) || res.Completion.HasMore {
+			t.Errorf("complete %s: total %d, hasMore %v for %d values", tt.params, res.Completion.Total, res.Completion.HasMore, len(res.Completion.Values))
+		}
+	}
+}
+
+func TestGetPrompt(t *testing.T) {
+	tests := []struct {
+		params string
+		want   string // part of the message text, or the error message
+	}{
+		{`{"name":"search","arguments":{"query":"cancel a task"}}`, `Search the documentation for "cancel a task" with the search_docs tool, read`},
+		{`{"name":"search","arguments":{"query":"hooks","collection":"react"}}`, `with the search_docs tool in the "react" collection`},
+		{`{"name":"search","arguments":{"query":" "}}`, "missing required argument: query"},
+		{`{"name":"other"}`, "unknown prompt: other"},
+	}
+	for _, tt := range tests {
+		raw, errMsg := callMCP(t, "prompts/get", tt.params)
+		if errMsg != "" {
+			if errMsg != tt.want {
+				t.Errorf("prompts/get %s: error %q, want %q", tt.params, errMsg, tt.want)
+			}
+			continue
+		}
+		var res struct {
+			Messages []struct {
+				Content mcpContent `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.Unmarshal(raw, &res); err != nil || len(res.Messages) != 1 {
+			t.Errorf("prompts/get %s: bad result %s", tt.params, raw)
+			continue
+		}
+		if got := res.Messages[0].Content.Text; !strings.Contains(got, tt.want) {
+			t.Errorf("prompts/get %s = %q, want it to contain %q", tt.params, got, tt.want)
+		}
+	}
+}
+
+func TestCompletedQueries(t *testing.T) {
+	tests := []struct {
+		text  string
+		words []string
+		want  string
+	}{
+		{"conf", []string{"config", "configure"}, "config|configure"},
+		{"open the conn", []string{"connection"}, "open the connection"},
+		{"tab\tsep", []string{"separator"}, "tab\tseparator"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(completedQueries(tt.text, tt.words), "|"); got != tt.want {
+			t.Errorf("completedQueries(%q, %q) = %q, want %q", tt.text, tt.words, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestHandler(t *testing.T) {
+	setupCollections(t, nil)
+	tests := []struct {
+		target      string
+		status      int
+		completions string // joined by "|"
+		titles      string // joined by "|"
+	}{
+		{"/suggest?q=inst", http.StatusOK, "install", "Install"},
+		{"/suggest?q=run+the+inst", http.StatusOK, "run the install", ""},
+		{"/suggest?q=canc&limit=1", http.StatusOK, "cancel", ""},
+		{"/suggest?q=", http.StatusBadRequest, "", ""},
+		{"/suggest?q=inst&limit=0", http.StatusBadRequest, "", ""},
+		{"/suggest?q=inst&collection=nosuch", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		suggestHandler(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rec.Code != tt.status {
+			t.Errorf("GET %s: status %d, want %d: %s", tt.target, rec.Code, tt.status, rec.Body)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var res struct {
+			Completions []string `json:"completions"`
+			Titles      []struct {
+				Title string `json:"title"`
+			} `json:"titles"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, ti := range res.Titles {
+			titles = append(titles, ti.Title)
+		}
+		if got := strings.Join(res.Completions, "|"); got != tt.completions {
+			t.Errorf("GET %s: completions %q, want %q", tt.target, got, tt.completions)
+		}
+		if got := strings.Join(titles, "|"); got != tt.titles {
+			t.Errorf("GET %s: titles %q, want %q", tt.target, got, tt.titles)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/deepersensor/documcp/crawler"
+	"github.com/deepersensor/documcp/scheduler"
+)
+
+// Defaults for crawls started over MCP, matching the CLI crawl command.
+const (
+	defaultCrawlDepth       = 2
+	defaultCrawlMaxPages    = 20
+	defaultCrawlConcurrency = 4
+	maxCrawlPages           = 1000
+)
+
+// crawlTools returns the tools that start and manage crawls.
+func crawlTools() []mcpTool {
+	return []mcpTool{
+		{
+			Name: "start_crawl",
+			Description: "Crawl and index a documentation site. Returns a job ID immediately; poll crawl_status, " +
+				"or set wait=true to block until indexing is done (with progress notifications if requested).",
+			InputSchema: objectSchema(map[string]any{
+				"url":         stringProp("Seed URL; only links on the same host are followed"),
+				"depth":       map[string]any{"type": "integer", "minimum": 0, "description": "Maximum link depth (default 2)"},
+				"max_pages":   map[string]any{"type": "integer", "minimum": 1, "maximum": maxCrawlPages, "description": "Maximum pages to fetch (default 20)"},
+				"concurrency": map[string]any{"type": "integer", "minimum": 1, "maximum": 16, "description": "Parallel fetches (default 4)"},
+				"wait":        map[string]any{"type": "boolean", "description": "Block until the crawl has been indexed"},
+				"collection":  stringProp("Collection to index into; created if it does not exist"),
+			}, "url"),
+			handler: startCrawlTool,
+		},
+		{
+			Name:        "crawl_status",
+			Description: "Report the progress of a crawl job, or of all jobs when no job_id is given.",
+			InputSchema: objectSchema(map[string]any{
+				"job_id": stringProp("Job ID returned by start_crawl"),
+			}),
+			handler: crawlStatusTool,
+		},
+		{
+			Name:        "cancel_crawl",
+			Description: "Stop a running crawl. Pages fetched so far are still indexed.",
+			InputSchema: objectSchema(map[string]any{
+				"job_id": stringProp("Job ID returned by start_crawl"),
+			}, "job_id"),
+			handler: cancelCrawlTool,
+		},
+	}
+}
+
+func startCrawlTool(ctx context.Context, raw json.RawMessage) (*mcpToolResult, error) {
+	if sched == nil {
+		return nil, errors.New("crawling is not available on this server")
+	}
+	var args struct {
+		URL         string `json:"url"`
+		Depth       *int   `json:"depth"`
+		MaxPages    int    `json:"max_pages"`
+		Concurrency int    `json:"concurrency"`
+		Wait        bool   `json:"wait"`
+		Collection  string `json:"collection"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	u, err := url.Parse(args.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url must be an absolute http(s) URL: %q", args.URL)
+	}
+	name := args.Collection
+	if name == "" {
+		name = defaultCollection
+	}
+	c, err := collections.GetOrCreate(name)
+	if err != nil {
+		return nil, err
+	}
+	opts := scheduler.CrawlOptions{
+		MaxDepth:    defaultCrawlDepth,
+		MaxPages:    defaultCrawlMaxPages,
+		Concurrency: defaultCrawlConcurrency,
+		OnFinish: func(job *scheduler.CrawlJob, results []crawler.CrawlResult) error {
+			if len(results) == 0 {
+				return nil
+			}
+			c.AddResults(results)
+			// A failed embedding leaves the crawl indexed for lexical
+			// search; the next crawl retries it.
+			if _, err := c.Embed(context.Background()); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to compute vectors, the next crawl will retry: %v\n", err)
+			}
+			NotifyDocumentsChanged()
+			return c.Save()
+		},
+	}
+	if args.Depth != nil && *args.Depth >= 0 {
+		opts.MaxDepth = *args.Depth
+	}
+	if args.MaxPages > 0 {
+		opts.MaxPages = min(args.MaxPages, maxCrawlPages)
+	}
+	if args.Concurrency > 0 {
+		opts.Concurrency = min(args.Concurrency, 16)
+	}
+	if args.Wait {
+		opts.OnPage = func(job *scheduler.CrawlJob, res crawler.CrawlResult) {
+			st := job.Status()
+			reportProgress(ctx, float64(st.Pages), float64(st.MaxPages), "Fetched "+res.URL)
+		}
+	}
+
+	job, err := sched.Submit(args.URL, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start crawl: %w", err)
+	}
+	if args.Wait {
+		select {
+		case <-job.Done():
+		case <-ctx.Done():
+			// The client gave up on the request; stop the crawl with it.
+			job.Cancel()
+			<-job.Done()
+		}
+	}
+	return jobResult(job.Status()), nil
+}
+
+func crawlStatusTool(ctx context.Context, raw json.RawMessage) (*mcpToolResult, error) {
+	if sched == nil {
+		return nil, errors.New("crawling is not available on this server")
+	}
+	var args struct {
+		JobID string `json:"job_id"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if args.JobID != "" {
+		job, ok := sched.Job(args.JobID)
+		if !ok {
+			return nil, fmt.Errorf("crawl job not found: %s", args.JobID)
+		}
+		return jobResult(job.Status()), nil
+	}
+	jobs := []scheduler.JobStatus{}
+	var sb strings.Builder
+	for _, job := range sched.Jobs() {
+		st := job.Status()
+		jobs = append(jobs, st)
+		sb.WriteString(formatJob(st) + "\n")
+	}
+	if len(jobs) == 0 {
+		sb.WriteString("No crawls have been started.")
+	}
+	return &mcpToolResult{
+		Content:           []mcpContent{{Type: "text", Text: strings.TrimSpace(sb.String())}},
+		StructuredContent: map[string]any{"jobs": jobs},
+	}, nil
+}
+
+func cancelCrawlTool(ctx context.Context, raw json.RawMessage) (*mcpToolResult, error) {
+	if sched == nil {
+		return nil, errors.New("crawling is not available on this server")
+	}
+	var args struct {
+		JobID string `json:"job_id"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	job, ok := sched.Job(args.JobID)
+	if !ok {
+		return nil, fmt.Errorf("crawl job not found: %s", args.JobID)
+	}
+	job.Cancel()
+	select {
+	case <-job.Done():
+	case <-ctx.Done():
+	}
+	return jobResult(job.Status()), nil
+}
+
+func jobResult(st scheduler.JobStatus) *mcpToolResult {
+	return &mcpToolResult{
+		Content:           []mcpContent{{Type: "text", Text: formatJob(st)}},
+		StructuredContent: st,
+	}
+}
+
+func formatJob(st scheduler.JobStatus) string {
+	s := fmt.Sprintf("Job %s: %s, %d/%d pages from %s", st.ProcessID, st.State, st.Pages, st.MaxPages, st.SeedURL)
+	if st.Error != "" {
+		s += " (error: " + st.Error + ")"
+	}
+	return s
+}
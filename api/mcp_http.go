@@ -0,0 +1,421 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Streamable HTTP transport headers.
+const (
+	mcpSessionHeader  = "Mcp-Session-Id"
+	mcpVersionHeader  = "Mcp-Protocol-Version"
+	maxMCPRequestSize = 4 << 20
+	sseKeepAlive      = 30 * time.Second
+	// mcpSessionIdleTimeout is how long a session without requests or open
+	// streams is kept before it is ended, as clients need not end them.
+	mcpSessionIdleTimeout = 30 * time.Minute
+)
+
+// mcpSession is one client connection over the Streamable HTTP transport.
+type mcpSession struct {
+	id       string
+	server   *MCPServer
+	mu       sync.Mutex
+	streams  map[chan []byte]struct{}
+	lastUsed time.Time
+	done     chan struct{}
+}
+
+// touch records that the session is in use.
+func (s *mcpSession) touch() {
+	s.mu.Lock()
+	s.lastUsed = time.Now()
+	s.mu.Unlock()
+}
+
+// idleSince reports whether the session has had no requests since t and
+// has no open streams.
+func (s *mcpSession) idleSince(t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams) == 0 && s.lastUsed.Before(t)
+}
+
+// broadcast delivers a server-initiated message to every open GET stream.
+// Messages are dropped when the session has no listener.
+func (s *mcpSession) broadcast(msg []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.streams {
+		select {
+		case ch <- msg:
+		default:
+			// Slow consumer; drop rather than block the server.
+		}
+	}
+}
+
+func (s *mcpSession) subscribe() chan []byte {
+	ch := make(chan []byte, 16)
+	s.mu.Lock()
+	s.streams[ch] = struct{}{}
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *mcpSession) unsubscribe(ch chan []byte) {
+	s.mu.Lock()
+	delete(s.streams, ch)
+	s.mu.Unlock()
+}
+
+var (
+	sessionsMu  sync.Mutex
+	mcpSessions = make(map[string]*mcpSession)
+	reaperOnce  sync.Once
+)
+
+// newSession creates a session with a random ID. It is not registered until
+// it has been initialized.
+func newSession() (*mcpSession, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	sess := &mcpSession{
+		id:       hex.EncodeToString(b),
+		streams:  make(map[chan []byte]struct{}),
+		lastUsed: time.Now(),
+		done:     make(chan struct{}),
+	}
+	sess.server = NewMCPServer(sess.broadcast)
+	return sess, nil
+}
+
+// registerSession makes a session available to later requests, and starts
+// the reaper of idle sessions with the first one.
+func registerSession(sess *mcpSession) {
+	registerServer(sess.server)
+	sessionsMu.Lock()
+	mcpSessions[sess.id] = sess
+	sessionsMu.Unlock()
+	reaperOnce.Do(func() {
+		go func() {
+			for range time.Tick(mcpSessionIdleTimeout / 4) {
+				reapSessions(time.Now().Add(-mcpSessionIdleTimeout))
+			}
+		}()
+	})
+}
+
+// reapSessions ends the sessions idle since before cutoff.
+func reapSessions(cutoff time.Time) {
+	var idle []*mcpSession
+	sessionsMu.Lock()
+	for _, sess := range mcpSessions {
+		if sess.idleSince(cutoff) {
+			idle = append(idle, sess)
+		}
+	}
+	sessionsMu.Unlock()
+	for _, sess := range idle {
+		endSession(sess)
+	}
+}
+
+// lookupSession returns the session named in the request header, writing an
+// HTTP error and returning nil if it is missing or unknown.
+func lookupSession(w http.ResponseWriter, r *http.Request) *mcpSession {
+	id := r.Header.Get(mcpSessionHeader)
+	if id == "" {
+		http.Error(w, "Missing "+mcpSessionHeader+" header", http.StatusBadRequest)
+		return nil
+	}
+	sessionsMu.Lock()
+	sess, ok := mcpSessions[id]
+	sessionsMu.Unlock()
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return nil
+	}
+	sess.touch()
+	return sess
+}
+
+// endSession unregisters a session and closes its streams.
+func endSession(sess *mcpSession) {
+	sessionsMu.Lock()
+	_, ok := mcpSessions[sess.id]
+	delete(mcpSessions, sess.id)
+	sessionsMu.Unlock()
+	if ok {
+		unregisterServer(sess.server)
+		close(sess.done)
+	}
+}
+
+// mcpHandler implements the MCP Streamable HTTP transport.
+func mcpHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowedOrigin(r) {
+		http.Error(w, "Forbidden origin", http.StatusForbidden)
+		return
+	}
+	if v := r.Header.Get(mcpVersionHeader); v != "" && !isSupportedVersion(v) {
+		http.Error(w, "Unsupported "+mcpVersionHeader+": "+v, http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		mcpPost(w, r)
+	case http.MethodGet:
+		mcpGet(w, r)
+	case http.MethodDelete:
+		if sess := lookupSession(w, r); sess != nil {
+			endSession(sess)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// mcpPost handles a JSON-RPC message, or a batch of them, sent by the
+// client.
+func mcpPost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMCPRequestSize))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	msgs, batch, err := decodeMessages(body)
+	if err != nil {
+		writeJSONRPC(w, http.StatusBadRequest, errorResponse(nil, codeParseError, "parse error"))
+		return
+	}
+	if batch {
+		mcpPostBatch(w, r, msgs)
+		return
+	}
+	msg := msgs[0]
+	if msg.Method == "initialize" && !msg.isNotification() {
+		mcpInitialize(w, r, &msg)
+		return
+	}
+	sess := lookupSession(w, r)
+	if sess == nil {
+		return
+	}
+	defer sess.touch()
+
+	if msg.isNotification() || msg.Method == "" {
+		sess.server.handle(r.Context(), &msg)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if wantsStream(r, &msg) {
+		streamResponse(w, r, sess, &msg)
+	} else {
+		writeJSONRPC(w, http.StatusOK, sess.server.handle(r.Context(), &msg))
+	}
+	if sess.server.Closed() {
+		endSession(sess)
+	}
+}
+
+// mcpInitialize starts a session. The session is only kept, and its ID
+// sent to the client, if initialization succeeds.
+func mcpInitialize(w http.ResponseWriter, r *http.Request, msg *rpcMessage) {
+	if r.Header.Get(mcpSessionHeader) != "" {
+		writeJSONRPC(w, http.StatusBadRequest, errorResponse(msg.ID, codeInvalidRequest, "session already initialized"))
+		return
+	}
+	sess, err := newSession()
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	resp := sess.server.handle(r.Context(), msg)
+	if resp.Error != nil {
+		writeJSONRPC(w, http.StatusBadRequest, resp)
+		return
+	}
+	registerSession(sess)
+	w.Header().Set(mcpSessionHeader, sess.id)
+	writeJSONRPC(w, http.StatusOK, resp)
+}
+
+// mcpPostBatch handles a batch of messages in an existing session and
+// answers with the array of responses to its requests.
+func mcpPostBatch(w http.ResponseWriter, r *http.Request, msgs []rpcMessage) {
+	sess := lookupSession(w, r)
+	if sess == nil {
+		return
+	}
+	defer sess.touch()
+	resps := sess.server.handleBatch(r.Context(), msgs)
+	if len(resps) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(encodeBatch(resps))
+	}
+	if sess.server.Closed() {
+		endSession(sess)
+	}
+}
+
+// wantsStream reports whether the response should be sent as an SSE stream.
+// Clients that accept only SSE always get a stream; clients that accept both
+// get one when they asked for progress notifications.
+func wantsStream(r *http.Request, msg *rpcMessage) bool {
+	accept := r.Header.Get("Accept")
+	if !strings.Contains(accept, "text/event-stream") {
+		return false
+	}
+	if !strings.Contains(accept, "application/json") {
+		return true
+	}
+	var p struct {
+		Meta struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	json.Unmarshal(msg.Params, &p)
+	return len(p.Meta.ProgressToken) > 0
+}
+
+// streamResponse handles a request, streaming its notifications and final
+// response as server-sent events.
+func streamResponse(w http.ResponseWriter, r *http.Request, sess *mcpSession, msg *rpcMessage) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONRPC(w, http.StatusOK, sess.server.handle(r.Context(), msg))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var wmu sync.Mutex
+	write := func(b []byte) {
+		wmu.Lock()
+		defer wmu.Unlock()
+		writeSSE(w, b)
+		flusher.Flush()
+	}
+	resp := sess.server.handle(withSink(r.Context(), write), msg)
+	write(encodeResponse(resp))
+}
+
+// mcpGet opens an SSE stream for server-initiated messages.
+func mcpGet(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		http.Error(w, "GET requires Accept: text/event-stream", http.StatusMethodNotAllowed)
+		return
+	}
+	sess := lookupSession(w, r)
+	if sess == nil {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch := sess.subscribe()
+	defer sess.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-ch:
+			writeSSE(w, msg)
+			flusher.Flush()
+		case <-ticker.C:
+			io.WriteString(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-sess.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeSSE(w io.Writer, msg []byte) {
+	fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+}
+
+func writeJSONRPC(w http.ResponseWriter, status int, resp *rpcResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(encodeResponse(resp))
+}
+
+func isSupportedVersion(v string) bool {
+	for _, sv := range supportedProtocolVersions {
+		if v == sv {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedOrigins holds the origins, besides loopback ones, whose browser
+// pages may call the MCP endpoint.
+var allowedOrigins map[string]bool
+
+// SetAllowedOrigins sets the origins, such as https://app.example.com,
+// allowed to call the MCP endpoint from a browser besides those on the
+// loopback interface. Entries that are not origins are ignored.
+func SetAllowedOrigins(origins []string) {
+	allowedOrigins = make(map[string]bool, len(origins))
+	for _, o := range origins {
+		if u, err := url.Parse(o); err == nil && u.Scheme != "" && u.Host != "" {
+			allowedOrigins[strings.ToLower(u.Scheme+"://"+u.Host)] = true
+		}
+	}
+}
+
+// allowedOrigin rejects cross-origin browser requests to guard against DNS
+// rebinding: only pages served from loopback hosts or from an allowed
+// origin may call the endpoint. The Host header cannot vouch for the
+// origin, as a rebound name sends its own. Requests without an Origin
+// header (non-browser clients) pass.
+func allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if allowedOrigins[strings.ToLower(u.Scheme+"://"+u.Host)] {
+		return true
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
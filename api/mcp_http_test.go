@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postMCP sends a JSON-RPC body to the MCP endpoint in the given session,
+// if any.
+func postMCP(t *testing.T, session, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if session != "" {
+		req.Header.Set(mcpSessionHeader, session)
+	}
+	rec := httptest.NewRecorder()
+	mcpHandler(rec, req)
+	return rec
+}
+
+// initSession initializes a session and returns its ID.
+func initSession(t *testing.T) string {
+	t.Helper()
+	rec := postMCP(t, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`)
+	id := rec.Header().Get(mcpSessionHeader)
+	if rec.Code != http.StatusOK || id == "" {
+		t.Fatalf("initialize: status %d, session %q: %s", rec.Code, id, rec.Body)
+	}
+	t.Cleanup(func() {
+		sessionsMu.Lock()
+		sess := mcpSessions[id]
+		sessionsMu.Unlock()
+		if sess != nil {
+			endSession(sess)
+		}
+	})
+	return id
+}
+
+func TestMCPSessionCreatedOnlyOnSuccessfulInitialize(t *testing.T) {
+	rec := postMCP(t, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":"not an object"}`)
+	if id := rec.Header().Get(mcpSessionHeader); id != "" {
+		t.Errorf("failed initialize set session %q", id)
+	}
+	sessionsMu.Lock()
+	n := len(mcpSessions)
+	sessionsMu.Unlock()
+	if n != 0 {
+		t.Errorf("failed initialize left %d sessions", n)
+	}
+	initSession(t)
+}
+
+func TestMCPBatch(t *testing.T) {
+	id := initSession(t)
+	tests := []struct {
+		body   string
+		status int
+		want   []string // expected response IDs, or error messages
+	}{
+		{`[{"jsonrpc":"2.0","id":2,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/initialized"},{"jsonrpc":"2.0","id":3,"method":"tools/list"}]`, http.StatusOK, []string{"2", "3"}},
+		{`[{"jsonrpc":"2.0","method":"notifications/initialized"}]`, http.StatusAccepted, nil},
+		{`[]`, http.StatusOK, []string{"empty batch"}},
+		{`[1, {"jsonrpc":"2.0","id":4,"method":"initialize"}]`, http.StatusOK, []string{"invalid request", "initialize must not be batched"}},
+	}
+	for _, tt := range tests {
+		rec := postMCP(t, id, tt.body)
+		if rec.Code != tt.status {
+			t.Errorf("POST %s: status %d, want %d", tt.body, rec.Code, tt.status)
+			continue
+		}
+		if tt.want == nil {
+			continue
+		}
+		var resps []rpcResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resps); err != nil {
+			t.Errorf("POST %s: %v: %s", tt.body, err, rec.Body)
+			continue
+		}
+		var got []string
+		for _, r := range resps {
+			if r.Error != nil {
+				got = append(got, r.Error.Message)
+			} else {
+				got = append(got, string(r.ID))
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("POST %s: responses %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestReapIdleSessions(t *testing.T) {
+	idle := initSession(t)
+	listening := initSession(t)
+	sessionsMu.Lock()
+	sess := mcpSessions[listening]
+	sessionsMu.Unlock()
+	defer sess.unsubscribe(sess.subscribe())
+
+	reapSessions(time.Now().Add(time.Minute))
+	if rec := postMCP(t, idle, `{"jsonrpc":"2.0","id":2,"method":"ping"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("idle session: status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := postMCP(t, listening, `{"jsonrpc":"2.0","id":2,"method":"ping"}`); rec.Code != http.StatusOK {
+		t.Errorf("session with an open stream: status %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestMCPOrigin(t *testing.T) {
+	SetAllowedOrigins([]string{"https://App.example.com"})
+	t.Cleanup(func() { SetAllowedOrigins(nil) })
+	tests := []struct {
+		origin, host string
+		allowed      bool
+	}{
+		{"", "localhost:8080", true},
+		{"http://localhost:8080", "localhost:8080", true},
+		{"http://127.0.0.1:3000", "localhost:8080", true},
+		{"http://[::1]:3000", "localhost:8080", true},
+		{"https://app.example.com", "docs.internal:8080", true},
+		// A rebound name sends a Host matching its Origin.
+		{"http://evil.example", "evil.example", false},
+		{"http://evil.example", "localhost:8080", false},
+		{"http://app.example.com", "docs.internal:8080", false},
+		{"https://app.example.com:8443", "docs.internal:8080", false},
+		{"null", "localhost:8080", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		req.Host = tt.host
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		rec := httptest.NewRecorder()
+		mcpHandler(rec, req)
+		if allowed := rec.Code != http.StatusForbidden; allowed != tt.allowed {
+			t.Errorf("Origin %q, Host %q: status %d, want allowed %v", tt.origin, tt.host, rec.Code, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/deepersensor/documcp/docstore"
+)
+
+// Resource URI scheme for crawled pages.
+const (
+	resourceDocPrefix = "documcp://doc/"
+	resourceURLPrefix = "documcp://url/"
+	resourcePageSize  = 50
+	resourceMIMEType  = "text/markdown"
+)
+
+// mcpResource describes a crawled page in resources/list.
+type mcpResource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	MIMEType    string `json:"mimeType"`
+}
+
+// mcpResourceTemplate describes a parameterised resource URI.
+type mcpResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MIMEType    string `json:"mimeType"`
+}
+
+// mcpResourceContents is one entry of a resources/read result.
+type mcpResourceContents struct {
+	URI      string `json:"uri"`
+	MIMEType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+var resourceTemplates = []mcpResourceTemplate{
+	{
+		URITemplate: resourceDocPrefix + "{id}{?collection}",
+		Name:        "document",
+		Description: "A crawled documentation page by document ID, in the default collection unless one is given",
+		MIMEType:    resourceMIMEType,
+	},
+	{
+		URITemplate: resourceURLPrefix + "{url}{?collection}",
+		Name:        "document-by-url",
+		Description: "The latest crawl of a documentation page by its percent-encoded URL, in the default collection unless one is given",
+		MIMEType:    resourceMIMEType,
+	},
+}
+
+var (
+	liveServersMu sync.Mutex
+	liveServers   = make(map[*MCPServer]struct{})
+)
+
+// registerServer makes s receive broadcast notifications until unregistered.
+func registerServer(s *MCPServer) {
+	liveServersMu.Lock()
+	liveServers[s] = struct{}{}
+	liveServersMu.Unlock()
+}
+
+func unregisterServer(s *MCPServer) {
+	liveServersMu.Lock()
+	delete(liveServers, s)
+	liveServersMu.Unlock()
+}
+
+// NotifyDocumentsChanged tells every connected MCP client that the resource
+// list has changed. Call it after a crawl adds or updates documents.
+func NotifyDocumentsChanged() {
+	liveServersMu.Lock()
+	servers := make([]*MCPServer, 0, len(liveServers))
+	for s := range liveServers {
+		servers = append(servers, s)
+	}
+	liveServersMu.Unlock()
+	for _, s := range servers {
+		s.mu.Lock()
+		ready := s.initialized && !s.closed
+		s.mu.Unlock()
+		if ready {
+			s.notify(context.Background(), "notifications/resources/list_changed", nil)
+		}
+	}
+}
+
+// collectionDoc is a document together with the collection it belongs to.
+type collectionDoc struct {
+	collection string
+	doc        *docstore.Document
+}
+
+// listResources returns one page of resources across all collections,
+// ordered by collection and URL.
+func listResources(params json.RawMessage) (any, error) {
+	var p struct {
+		Cursor string `json:"cursor"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: "invalid resources/list params"}
+		}
+	}
+	offset := 0
+	if p.Cursor != "" {
+		var ok bool
+		if offset, ok = decodeCursor(p.Cursor); !ok {
+			return nil, &rpcError{Code: codeInvalidParams, Message: "invalid cursor"}
+		}
+	}
+
+	names, err := collections.List()
+	if err != nil {
+		return nil, err
+	}
+	var docs []collectionDoc
+	for _, name := range names {
+		c, err := collections.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		start := len(docs)
+		for _, d := range c.Docs.Pages() {
+			docs = append(docs, collectionDoc{collection: name, doc: d})
+		}
+		added := docs[start:]
+		sort.Slice(added, func(i, j int) bool {
+			if added[i].doc.URL != added[j].doc.URL {
+				return added[i].doc.URL < added[j].doc.URL
+			}
+			return added[i].doc.ID < added[j].doc.ID
+		})
+	}
+
+	resources := []mcpResource{}
+	for i := offset; i < len(docs) && i < offset+resourcePageSize; i++ {
+		resources = append(resources, resourceFor(docs[i].collection, docs[i].doc))
+	}
+	result := map[string]any{"resources": resources}
+	if next := offset + resourcePageSize; next < len(docs) {
+		result["nextCursor"] = encodeCursor(next)
+	}
+	return result, nil
+}
+
+// readResource resolves a documcp:// URI and renders the page as markdown.
+func readResource(params json.RawMessage) (any, error) {
+	var p struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil || p.URI == "" {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "invalid resources/read params"}
+	}
+	d, err := resolveResource(p.URI)
+	if err != nil {
+		// -32002 is the MCP "resource not found" error code.
+		return nil, &rpcError{Code: -32002, Message: err.Error()}
+	}
+	return map[string]any{
+		"contents": []mcpResourceContents{{
+			URI:      p.URI,
+			MIMEType: resourceMIMEType,
+			Text:     renderMarkdown(d),
+		}},
+	}, nil
+}
+
+// resolveResource finds the document a documcp:// URI refers to.
+func resolveResource(uri string) (*docstore.Document, error) {
+	rest, rawQuery, _ := strings.Cut(uri, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resource URI: %s", uri)
+	}
+	c, err := getCollection(query.Get("collection"))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasPrefix(rest, resourceDocPrefix):
+		return findDocument(c, strings.TrimPrefix(rest, resourceDocPrefix), "")
+	case strings.HasPrefix(rest, resourceURLPrefix):
+		pageURL, err := url.PathUnescape(strings.TrimPrefix(rest, resourceURLPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource URI: %s", uri)
+		}
+		return findDocument(c, "", pageURL)
+	}
+	return nil, fmt.Errorf("unsupported resource URI: %s", uri)
+}
+
+// resourceURI returns the URI of a document; the collection is only spelled
+// out when it differs from the default.
+func resourceURI(collectionName, id string) string {
+	uri := resourceDocPrefix + id
+	if collectionName != defaultCollection {
+		uri += "?collection=" + url.QueryEscape(collectionName)
+	}
+	return uri
+}
+
+func resourceFor(collectionName string, d *docstore.Document) mcpResource {
+	name := d.Title
+	if name == "" {
+		name = d.URL
+	}
+	return mcpResource{
+		URI:         resourceURI(collectionName, d.ID),
+		Name:        name,
+		Title:       d.Title,
+		Description: d.URL,
+		MIMEType:    resourceMIMEType,
+	}
+}
+
+// renderMarkdown formats a document for MCP clients.
+func renderMarkdown(d *docstore.Document) string {
+	var sb strings.Builder
+	title := d.Title
+	if title == "" {
+		title = d.URL
+	}
+	if d.IsSection() {
+		title += " > " + strings.Join(d.Path, " > ")
+	}
+	fmt.Fprintf(&sb, "# %s\n\nSource: %s\n\n", title, d.URL)
+	sb.WriteString(d.Text)
+	for _, code := range d.CodeSnippets {
+		sb.WriteString("\n\n```\n" + strings.TrimSpace(code) + "\n```")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/deepersensor/documcp/collection/collectiontest"
+	"github.com/deepersensor/documcp/docstore"
+)
+
+func TestListResources(t *testing.T) {
+	c := setupCollections(t, nil)
+	raw, errMsg := callMCP(t, "resources/list", `{}`)
+	if errMsg != "" {
+		t.Fatal(errMsg)
+	}
+	var res struct {
+		Resources  []mcpResource `json:"resources"`
+		NextCursor string        `json:"nextCursor"`
+	}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range res.Resources {
+		names = append(names, r.Name)
+	}
+	if got := strings.Join(names, "|"); got != "Install|Task Runner" {
+		t.Errorf("resources %q, want the pages ordered by URL", got)
+	}
+	if res.NextCursor != "" {
+		t.Errorf("nextCursor = %q for a single page", res.NextCursor)
+	}
+
+	// Page through more resources than fit in one response.
+	for i := 0; i < resourcePageSize; i++ {
+		id := fmt.Sprintf("extra%d", i)
+		c.Docs.Put(docstore.NewDocument(id, fmt.Sprintf("http://example.com/p/%d", i), "", "filler", nil, nil, nil, 1))
+	}
+	seen := 0
+	cursor := ""
+	for calls := 0; calls < 5; calls++ {
+		raw, errMsg := callMCP(t, "resources/list", `{"cursor":"`+cursor+`"}`)
+		if errMsg != "" {
+			t.Fatal(errMsg)
+		}
+		res.NextCursor = ""
+		if err := json.Unmarshal(raw, &res); err != nil {
+			t.Fatal(err)
+		}
+		seen += len(res.Resources)
+		if cursor = res.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if want := resourcePageSize + len(collectiontest.Pages); seen != want {
+		t.Errorf("paged through %d resources, want %d", seen, want)
+	}
+
+	if _, errMsg := callMCP(t, "resources/list", `{"cursor":"bogus"}`); errMsg != "invalid cursor" {
+		t.Errorf("bad cursor: error %q, want %q", errMsg, "invalid cursor")
+	}
+}
+
+func TestReadResource(t *testing.T) {
+	c := setupCollections(t, nil)
+	jobs, err := findDocument(c, "", "http://example.com/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		uri  string
+		want string // part of the rendered page, or the error message
+	}{
+		{resourceDocPrefix + jobs.ID, "# Task Runner\n\nSource: http://example.com/jobs\n\nTask Runner\n"},
+		{resourceURLPrefix + "http%3A%2F%2Fexample.com%2Finstall", "# Install\n\nSource: http://example.com/install\n\nRun the installer"},
+		{resourceDocPrefix + jobs.ID + "?collection=default", "# Task Runner\n"},
+		{resourceDocPrefix + jobs.ID + "?collection=nosuch", "collection not found: nosuch"},
+		{resourceDocPrefix + "nosuch", "document not found: nosuch"},
+		{resourceURLPrefix + "http%3A%2F%2Fexample.com%2Fnosuch", "no document for URL: http://example.com/nosuch"},
+		{"documcp://other/x", "unsupported resource URI: documcp://other/x"},
+	}
+	for _, tt := range tests {
+		raw, errMsg := callMCP(t, "resources/read", `{"uri":"`+tt.uri+`"}`)
+		if errMsg != "" {
+			if errMsg != tt.want {
+				t.Errorf("read %s: error %q, want %q", tt.uri, errMsg, tt.want)
+			}
+			continue
+		}
+		var res struct {
+			Contents []mcpResourceContents `json:"contents"`
+		}
+		if err := json.Unmarshal(raw, &res); err != nil || len(res.Contents) != 1 {
+			t.Errorf("read %s: bad result %s", tt.uri, raw)
+			continue
+		}
+		if got := res.Contents[0].Text; !strings.Contains(got, tt.want) {
+			t.Errorf("read %s:\n%s\ndoes not contain\n%s", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestResourceURI(t *testing.T) {
+	tests := []struct {
+		collection, id, want string
+	}{
+		{defaultCollection, "abc", "documcp://doc/abc"},
+		{"react-docs", "abc", "documcp://doc/abc?collection=react-docs"},
+	}
+	for _, tt := range tests {
+		if got := resourceURI(tt.collection, tt.id); got != tt.want {
+			t.Errorf("resourceURI(%q, %q) = %q, want %q", tt.collection, tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// serveLines runs a stdio server over the given input lines and returns its
+// responses by request ID.
+func serveLines(t *testing.T, lines ...string) map[string]rpcResponse {
+	t.Helper()
+	var out bytes.Buffer
+	if err := ServeStdio(strings.NewReader(strings.Join(lines, "\n")+"\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	resps := make(map[string]rpcResponse)
+	sc := bufio.NewScanner(&out)
+	for sc.Scan() {
+		var batch []rpcResponse
+		if json.Unmarshal(sc.Bytes(), &batch) != nil {
+			var r rpcResponse
+			if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+				t.Fatalf("bad response %s: %v", sc.Bytes(), err)
+			}
+			batch = []rpcResponse{r}
+		}
+		for _, r := range batch {
+			resps[string(r.ID)] = r
+		}
+	}
+	return resps
+}
+
+func TestServeStdio(t *testing.T) {
+	const initialize = `{"jsonrpc":"2.0","id":"init","method":"initialize","params":{"protocolVersion":"2025-06-18"}}`
+	tests := []struct {
+		name  string
+		lines []string
+		want  map[string]string // request ID -> error message, "" for success
+	}{
+		{
+			name:  "requests before initialize fail",
+			lines: []string{`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`, initialize, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`},
+			want:  map[string]string{"1": "server not initialized", `"init"`: "", "2": ""},
+		},
+		{
+			name:  "ping before initialize",
+			lines: []string{`{"jsonrpc":"2.0","id":1,"method":"ping"}`},
+			want:  map[string]string{"1": ""},
+		},
+		{
+			name:  "batch",
+			lines: []string{initialize, `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","id":2,"method":"nope"}]`},
+			want:  map[string]string{`"init"`: "", "1": "", "2": "method not found: nope"},
+		},
+		{
+			name:  "parse error",
+			lines: []string{`{"jsonrpc":`},
+			want:  map[string]string{"null": "parse error"},
+		},
+	}
+	for _, tt := range tests {
+		resps := serveLines(t, tt.lines...)
+		if len(resps) != len(tt.want) {
+			t.Errorf("%s: got %d responses, want %d", tt.name, len(resps), len(tt.want))
+		}
+		for id, want := range tt.want {
+			r, ok := resps[id]
+			var got string
+			if r.Error != nil {
+				got = r.Error.Message
+			}
+			if !ok || got != want {
+				t.Errorf("%s: response %s error %q (present %v), want %q", tt.name, id, got, ok, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,572 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/deepersensor/documcp/collection"
+	"github.com/deepersensor/documcp/docstore"
+	"github.com/deepersensor/documcp/index"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+	previewLength      = 300
+
+	defaultContextTokens = 2000
+	maxContextTokens     = 100000
+)
+
+var (
+	collectionProp = stringProp("Collection to use; defaults to the server's default collection")
+	modeProp       = map[string]any{
+		"type":        "string",
+		"enum":        []string{collection.ModeLexical, collection.ModeVector, collection.ModeHybrid},
+		"description": "lexical (default) matches the query's words and operators; vector matches by meaning, for questions like \"how do I stop a job\"; hybrid combines both",
+	}
+)
+
+// defaultTools returns the tools backed by the global index and docstore.
+func defaultTools() []mcpTool {
+	return []mcpTool{
+		{
+			Name:        "search_docs",
+			Description: "Full-text search over crawled documentation. Returns matching pages with IDs, URLs, the section that matches best (its heading path, anchor URL and section ID, which get_document accepts) and a passage from it with matched words highlighted.",
+			InputSchema: objectSchema(map[string]any{
+				"query":          stringProp(`Search terms; all terms must match unless combined with OR. Supports NOT or -term to exclude, +term to require (other terms then become optional), parentheses, "quoted words" for an exact phrase, a NEAR/n b for words within n positions of each other, conf* for words starting with conf, and title:, heading:, body: or code: prefixes to search one field. Results are ranked by relevance`),
+				"limit":          map[string]any{"type": "integer", "minimum": 1, "maximum": maxSearchLimit, "description": "Maximum number of results (default 10)"},
+				"source":         stringProp("Only return pages from this host (e.g. react.dev) or URL prefix"),
+				"highlight_pre":  stringProp("Marker inserted before each matched word in previews (default **)"),
+				"highlight_post": stringProp("Marker inserted after each matched word in previews (default **)"),
+				"full_text":      map[string]any{"type": "boolean", "description": "Include each page's full text in the structured results"},
+				"mode":           modeProp,
+				"collection":     collectionProp,
+			}, "query"),
+			handler: searchDocsTool,
+		},
+		{
+			Name:        "get_document",
+			Description: "Fetch a crawled page by ID or URL, including its text, headings and code snippets.",
+			InputSchema: objectSchema(map[string]any{
+				"id":         stringProp("Document ID returned by search_docs"),
+				"url":        stringProp("Page URL, used when no ID is given"),
+				"collection": collectionProp,
+			}),
+			handler: getDocumentTool,
+		},
+		{
+			Name:        "list_sources",
+			Description: "List the documentation sites that have been crawled, with page counts, grouped by collection.",
+			InputSchema: objectSchema(map[string]any{
+				"collection": stringProp("Only list sources in this collection"),
+			}),
+			handler: listSourcesTool,
+		},
+		{
+			Name:        "get_section",
+			Description: "Fetch a single section of a page: the text under the given heading up to the next heading.",
+			InputSchema: objectSchema(map[string]any{
+				"id":         stringProp("Document ID returned by search_docs"),
+				"url":        stringProp("Page URL, used when no ID is given"),
+				"heading":    stringProp("Heading text to look up (case-insensitive)"),
+				"collection": collectionProp,
+			}, "heading"),
+			handler: getSectionTool,
+		},
+		{
+			Name:        "get_context",
+			Description: "Answer-ready context for a question: the sections best matching the query, most relevant first, packed to fit a token budget. Repeated text is included once, and each section comes with its source URL and heading path. Use this instead of search_docs followed by get_document when the text itself is needed.",
+			InputSchema: objectSchema(map[string]any{
+				"query":      stringProp("Search terms, with the same syntax as search_docs"),
+				"max_tokens": map[string]any{"type": "integer", "minimum": 1, "maximum": maxContextTokens, "description": "Approximate number of tokens the context may take up (default 2000)"},
+				"source":     stringProp("Only use pages from this host (e.g. react.dev) or URL prefix"),
+				"mode":       modeProp,
+				"collection": collectionProp,
+			}, "query"),
+			handler: getContextTool,
+		},
+	}
+}
+
+func searchDocsTool(ctx context.Context, raw json.RawMessage) (*mcpToolResult, error) {
+	var args struct {
+		Query         string  `json:"query"`
+		Limit         int     `json:"limit"`
+		Source        string  `json:"source"`
+		HighlightPre  *string `json:"highlight_pre"`
+		HighlightPost *string `json:"highlight_post"`
+		FullText      bool    `json:"full_text"`
+		Mode          string  `json:"mode"`
+		Collection    string  `json:"collection"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return nil, errors.New("query must not be empty")
+	}
+	limit := clampLimit(args.Limit)
+	c, err := getCollection(args.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	type section struct {
+		ID   string   `json:"id"`
+		URL  string   `json:"url"`
+		Path []string `json:"path,omitempty"`
+	}
+	type hit struct {
+		ID      string   `json:"id"`
+		URL     string   `json:"url"`
+		Title   string   `json:"title,omitempty"`
+		Score   float64  `json:"score"`
+		Section *section `json:"section,omitempty"`
+		Preview string   `json:"preview"`
+		Text    string   `json:"text,omitempty"`
+	}
+	opts := index.SnippetOptions{Length: previewLength, Pre: index.DefaultHighlightPre, Post: index.DefaultHighlightPost}
+	if args.HighlightPre != nil {
+		opts.Pre = *args.HighlightPre
+	}
+	if args.HighlightPost != nil {
+		opts.Post = *args.HighlightPost
+	}
+	results, total, err := c.Search(ctx, args.Query, collection.SearchOptions{
+		Limit:  limit,
+		Mode:   args.Mode,
+		Filter: func(page *docstore.Document) bool { return matchesSource(page.URL, args.Source) },
+	})
+	if err != nil {
+		return nil, err
+	}
+	hl := c.Index.Highlighter(args.Query, opts)
+	hits := []hit{}
+	var sb strings.Builder
+	for _, r := range results {
+		d := r.Doc
+		h := hit{ID: d.ID, URL: d.URL, Title: d.Title, Score: r.Score}
+		passage := d.Text
+		if sec := r.Section; sec != nil {
+			h.Section = &section{ID: sec.ID, URL: sec.URL, Path: sec.Path}
+			passage = sec.Text
+		}
+		h.Preview = hl.Snippet(passage)
+		if args.FullText {
+			h.Text = d.Text
+		}
+		hits = append(hits, h)
+
+		fmt.Fprintf(&sb, "[%s] %s (score %.2f)\n", h.ID, h.URL, h.Score)
+		if h.Title != "" {
+			fmt.Fprintf(&sb, "Title: %s\n", h.Title)
+		}
+		if h.Section != nil {
+			label := strings.Join(h.Section.Path, " > ")
+			if label == "" {
+				label = "(top of page)"
+			}
+			fmt.Fprintf(&sb, "Section [%s]: %s (%s)\n", h.Section.ID, label, h.Section.URL)
+		}
+		fmt.Fprintf(&sb, "  %s\n\n", h.Preview)
+	}
+	if len(hits) == 0 {
+		fmt.Fprintf(&sb, "No results for %q\n", args.Query)
+	}
+	suggestions := c.Suggest(args.Query, total)
+	for _, s := range suggestions {
+		fmt.Fprintf(&sb, "Did you mean: %s\n", s)
+	}
+	structured := map[string]any{"results": hits}
+	if len(suggestions) > 0 {
+		structured["suggestions"] = suggestions
+	}
+	return &mcpToolResult{
+		Content:           []mcpContent{{Type: "text", Text: strings.TrimSpace(sb.String())}},
+		StructuredContent: structured,
+	}, nil
+}
+
+func getDocumentTool(ctx context.Context, raw json.RawMessage) (*mcpToolResult, error) {
+	var args struct {
+		ID         string `json:"id"`
+		URL        string `json:"url"`
+		Collection string `json:"collection"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	c, err := getCollection(args.Collection)
+	if err != nil {
+		return nil, err
+	}
+	d, err := findDocument(c, args.ID, args.URL)
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "URL: %s\n", d.URL)
+	if d.Title != "" {
+		fmt.Fprintf(&sb, "Title: %s\n", d.Title)
+	}
+	if len(d.Headings) > 0 {
+		fmt.Fprintf(&sb, "Headings: %s\n", strings.Join(d.Headings, " | "))
+	}
+	sb.WriteString("\n" + d.Text)
+	for _, code := range d.CodeSnippets {
+		sb.WriteString("\n\n```\n" + strings.TrimSpace(code) + "\n```")
+	}
+	return &mcpToolResult{
+		Content:           []mcpContent{{Type: "text", Text: sb.String()}},
+		StructuredContent: d,
+	}, nil
+}
+
+func listSourcesTool(ctx context.Context, raw json.RawMessage) (*mcpToolResult, error) {
+	var args struct {
+		Collection string `json:"collection"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	names := []string{args.Collection}
+	if args.Collection == "" {
+		var err error
+		if names, err = collections.List(); err != nil {
+			return nil, err
+		}
+	}
+	type source struct {
+		Collection string `json:"collection"`
+		Host       string `json:"host"`
+		Pages      int    `json:"pages"`
+	}
+	sources := []source{}
+	for _, name := range names {
+		c, err := collections.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		counts := make(map[string]int)
+		for _, d := range c.Docs.Pages() {
+			counts[hostOf(d.URL)]++
+		}
+		start := len(sources)
+		for host, n := range counts {
+			sources = append(sources, source{Collection: name, Host: host, Pages: n})
+		}
+		added := sources[start:]
+		sort.Slice(added, func(i, j int) bool { return added[i].Host < added[j].Host })
+	}
+
+	var sb strings.Builder
+	for _, s := range sources {
+		fmt.Fprintf(&sb, "[%s] %s (%d pages)\n", s.Collection, s.Host, s.Pages)
+	}
+	if len(sources) == 0 {
+		sb.WriteString("No documentation has been crawled yet.")
+	}
+	return &mcpToolResult{
+		Content:           []mcpContent{{Type: "text", Text: strings.TrimSpace(sb.String())}},
+		StructuredContent: map[string]any{"sources": sources},
+	}, nil
+}
+
+func getSectionTool(ctx context.Context, raw json.RawMessage) (*mcpToolResult, error) {
+	var args struct {
+		ID         string `json:"id"`
+		URL        string `json:"url"`
+		Heading    string `json:"heading"`
+		Collection string `json:"collection"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if strings.TrimSpace(args.Heading) == "" {
+		return nil, errors.New("heading must not be empty")
+	}
+	c, err := getCollection(args.Collection)
+	if err != nil {
+		return nil, err
+	}
+	d, err := findDocument(c, args.ID, args.URL)
+	if err != nil {
+		return nil, err
+	}
+	if sec := findSection(c, d, args.Heading); sec != nil {
+		heading := sec.Path[len(sec.Path)-1]
+		return &mcpToolResult{
+			Content: []mcpContent{{Type: "text", Text: heading + "\n\n" + sec.Text}},
+			StructuredContent: map[string]any{
+				"id":        sec.ID,
+				"url":       sec.URL,
+				"parent_id": d.ID,
+				"path":      sec.Path,
+				"heading":   heading,
+				"text":      sec.Text,
+			},
+		}, nil
+	}
+	heading, text, ok := extractSection(d, args.Heading)
+	if !ok {
+		return nil, fmt.Errorf("heading %q not found in %s; available headings: %s",
+			args.Heading, d.ID, strings.Join(d.Headings, " | "))
+	}
+	return &mcpToolResult{
+		Content: []mcpContent{{Type: "text", Text: heading + "\n\n" + text}},
+		StructuredContent: map[string]any{
+			"id":      d.ID,
+			"url":     d.URL,
+			"heading": heading,
+			"text":    text,
+		},
+	}, nil
+}
+
+// findDocument looks up a page in c by ID, or by URL when id is empty. If a
+// URL was crawled more than once the most recent version wins.
+func findDocument(c *collection.Collection, id, pageURL string) (*docstore.Document, error) {
+	if id != "" {
+		if d, ok := c.Docs.Get(id); ok {
+			return d, nil
+		}
+		return nil, fmt.Errorf("document not found: %s", id)
+	}
+	if pageURL == "" {
+		return nil, errors.New("either id or url is required")
+	}
+	var best *docstore.Document
+	for _, d := range c.Docs.Pages() {
+		if d.URL != pageURL {
+			continue
+		}
+		if best == nil || d.Version > best.Version || (d.Version == best.Version && d.LastUpdated.After(best.LastUpdated)) {
+			best = d
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no document for URL: %s", pageURL)
+	}
+	return best, nil
+}
+
+// findSection returns the section of page d under the wanted heading, matched
+// like extractSection, or nil if there is none. Pages indexed before they
+// were split into sections have none.
+func findSection(c *collection.Collection, d *docstore.Document, want string) *docstore.Document {
+	want = strings.ToLower(strings.TrimSpace(want))
+	var sections []*docstore.Document
+	for _, id := range d.Sections {
+		if sec, ok := c.Docs.Get(id); ok && len(sec.Path) > 0 {
+			sections = append(sections, sec)
+		}
+	}
+	for _, sec := range sections {
+		if strings.ToLower(sec.Path[len(sec.Path)-1]) == want {
+			return sec
+		}
+	}
+	for _, sec := range sections {
+		if strings.Contains(strings.ToLower(sec.Path[len(sec.Path)-1]), want) {
+			return sec
+		}
+	}
+	return nil
+}
+
+// extractSection returns the text between the matching heading and the next
+// heading of the page. Headings are matched case-insensitively, exact matches
+// first and then by substring.
+func extractSection(d *docstore.Document, want string) (string, string, bool) {
+	want = strings.ToLower(strings.TrimSpace(want))
+	pos := -1
+	for i, h := range d.Headings {
+		if strings.ToLower(strings.TrimSpace(h)) == want {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		for i, h := range d.Headings {
+			if strings.Contains(strings.ToLower(h), want) {
+				pos = i
+				break
+			}
+		}
+	}
+	if pos < 0 {
+		return "", "", false
+	}
+	heading := strings.TrimSpace(d.Headings[pos])
+
+	// Locate each heading in order so repeated titles resolve to the right one.
+	offset := 0
+	start := -1
+	for i := 0; i <= pos; i++ {
+		h := strings.TrimSpace(d.Headings[i])
+		j := strings.Index(d.Text[offset:], h)
+		if j < 0 {
+			continue
+		}
+		offset += j
+		if i == pos {
+			start = offset + len(h)
+		} else {
+			offset += len(h)
+		}
+	}
+	if start < 0 {
+		return heading, "", true
+	}
+	end := len(d.Text)
+	for _, h := range d.Headings[pos+1:] {
+		if j := strings.Index(d.Text[start:], strings.TrimSpace(h)); j >= 0 {
+			end = start + j
+			break
+		}
+	}
+	return heading, strings.TrimSpace(d.Text[start:end]), true
+}
+
+func getContextTool(ctx context.Context, raw json.RawMessage) (*mcpToolResult, error) {
+	var args struct {
+		Query      string `json:"query"`
+		MaxTokens  int    `json:"max_tokens"`
+		Source     string `json:"source"`
+		Mode       string `json:"mode"`
+		Collection string `json:"collection"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return nil, errors.New("query must not be empty")
+	}
+	c, err := getCollection(args.Collection)
+	if err != nil {
+		return nil, err
+	}
+	pack, err := c.PackContext(ctx, args.Query, collection.PackOptions{
+		Budget: clampBudget(args.MaxTokens),
+		Mode:   args.Mode,
+		Filter: func(page *docstore.Document) bool { return matchesSource(page.URL, args.Source) },
+	})
+	if err != nil {
+		return nil, err
+	}
+	text := pack.String()
+	if len(pack.Chunks) == 0 {
+		text = fmt.Sprintf("No results for %q", args.Query)
+		if pack.Omitted > 0 {
+			text = fmt.Sprintf("No section of the results for %q fits in %d tokens", args.Query, pack.Budget)
+		}
+	} else if pack.Omitted > 0 {
+		text += fmt.Sprintf("\n(%d more matching sections did not fit in %d tokens)", pack.Omitted, pack.Budget)
+	}
+	return &mcpToolResult{
+		Content:           []mcpContent{{Type: "text", Text: strings.TrimSpace(text)}},
+		StructuredContent: contextResponse(pack),
+	}, nil
+}
+
+// contextChunk is the JSON form of a collection.Chunk.
+type contextChunk struct {
+	ID        string   `json:"id"`
+	PageID    string   `json:"page_id"`
+	URL       string   `json:"url"`
+	Title     string   `json:"title,omitempty"`
+	Path      []string `json:"path,omitempty"`
+	Score     float64  `json:"score"`
+	Tokens    int      `json:"tokens"`
+	Truncated bool     `json:"truncated,omitempty"`
+	Text      string   `json:"text"`
+}
+
+// contextResponse is the JSON form of a context pack shared by /context and
+// get_context.
+func contextResponse(p *collection.ContextPack) map[string]any {
+	chunks := make([]contextChunk, len(p.Chunks))
+	for i, ch := range p.Chunks {
+		chunks[i] = contextChunk{
+			ID:        ch.ID,
+			PageID:    ch.PageID,
+			URL:       ch.URL,
+			Title:     ch.Title,
+			Path:      ch.Path,
+			Score:     ch.Score,
+			Tokens:    ch.Tokens,
+			Truncated: ch.Truncated,
+			Text:      ch.Text,
+		}
+	}
+	return map[string]any{
+		"budget":  p.Budget,
+		"tokens":  p.Tokens,
+		"omitted": p.Omitted,
+		"chunks":  chunks,
+	}
+}
+
+// matchesSource reports whether pageURL belongs to source, given as either a
+// host name or a URL prefix. An empty source matches everything.
+func matchesSource(pageURL, source string) bool {
+	if source == "" {
+		return true
+	}
+	if strings.Contains(source, "://") {
+		return strings.HasPrefix(pageURL, source)
+	}
+	return strings.TrimPrefix(hostOf(pageURL), "www.") == strings.TrimPrefix(source, "www.")
+}
+
+func hostOf(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil || u.Host == "" {
+		return pageURL
+	}
+	return u.Host
+}
+
+func clampLimit(n int) int {
+	if n <= 0 {
+		return defaultSearchLimit
+	}
+	if n > maxSearchLimit {
+		return maxSearchLimit
+	}
+	return n
+}
+
+// clampBudget returns the context token budget to use for a requested one.
+func clampBudget(n int) int {
+	if n <= 0 {
+		return defaultContextTokens
+	}
+	return min(n, maxContextTokens)
+}
+
+func objectSchema(props map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func stringProp(desc string) map[string]any {
+	return map[string]any{"type": "string", "description": desc}
+}
+
+// toolError builds a tool result that reports an error to the model.
+func toolError(msg string) *mcpToolResult {
+	return &mcpToolResult{
+		Content: []mcpContent{{Type: "text", Text: msg}},
+		IsError: true,
+	}
+}
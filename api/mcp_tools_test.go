@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/deepersensor/documcp/collection"
+	"github.com/deepersensor/documcp/collection/collectiontest"
+	"github.com/deepersensor/documcp/embed"
+	"github.com/deepersensor/documcp/index"
+)
+
+// setupCollections serves a default collection holding
+// collectiontest.Pages from a temporary directory. A nil embedder means the
+// hash embedder.
+func setupCollections(t *testing.T, embedder embed.Embedder) *collection.Collection {
+	t.Helper()
+	analyzer, err := index.NewAnalyzer(index.DefaultAnalyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if embedder == nil {
+		embedder = embed.NewHashEmbedder(embed.DefaultHashDim, analyzer)
+	}
+	m := collection.NewManager(t.TempDir(), index.DefaultRanking(), analyzer, embedder, index.DefaultHNSWParams)
+	SetCollections(m, collection.DefaultName)
+	c, err := m.GetOrCreate(collection.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AddResults(collectiontest.Pages)
+	return c
+}
+
+// callMCP sends one request to an initialized MCPServer and returns its
+// result, or its error message.
+func callMCP(t *testing.T, method, params string) (json.RawMessage, string) {
+	t.Helper()
+	s := NewMCPServer(nil)
+	ctx := context.Background()
+	s.HandleMessage(ctx, []byte(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`))
+	raw := s.HandleMessage(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"`+method+`","params":`+params+`}`))
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		t.Fatalf("%s: bad response %s: %v", method, raw, err)
+	}
+	if resp.Error != nil {
+		return nil, resp.Error.Message
+	}
+	return resp.Result, ""
+}
+
+func TestMCPTools(t *testing.T) {
+	setupCollections(t, nil)
+	tests := []struct {
+		tool    string
+		args    string
+		want    []string // substrings of the text content
+		isError bool
+	}{
+		{
+			tool: "search_docs",
+			args: `{"query":"abort"}`,
+			want: []string{"http://example.com/jobs", "Title: Task Runner", "Task Runner > Cancel a task (http://example.com/jobs#cancel)", "**abort**"},
+		},
+		{
+			tool: "search_docs",
+			args: `{"query":"abort","highlight_pre":"<","highlight_post":">"}`,
+			want: []string{"<abort>"},
+		},
+		{
+			tool: "search_docs",
+			args: `{"query":"conection"}`,
+			want: []string{"Did you mean: connection"},
+		},
+		{
+			tool: "search_docs",
+			args: `{"query":"installer","source":"other.example.com"}`,
+			want: []string{`No results for "installer"`},
+		},
+		{tool: "search_docs", args: `{"query":"  "}`, want: []string{"query must not be empty"}, isError: true},
+		{
+			tool: "get_document",
+			args: `{"url":"http://example.com/jobs"}`,
+			want: []string{"URL: http://example.com/jobs\nTitle: Task Runner\nHeadings: Task Runner | Cancel a task\n", "abort a running task"},
+		},
+		{tool: "get_document", args: `{"id":"nosuch"}`, want: []string{"document not found: nosuch"}, isError: true},
+		{tool: "get_document", args: `{}`, want: []string{"either id or url is required"}, isError: true},
+		{
+			tool: "get_section",
+			args: `{"url":"http://example.com/jobs","heading":"cancel A TASK"}`,
+			want: []string{"Cancel a task\n\nCall runner.Cancel(id) to abort a running task."},
+		},
+		{
+			tool: "get_section",
+			args: `{"url":"http://example.com/jobs","heading":"cancel"}`,
+			want: []string{"Cancel a task\n\n"},
+		},
+		{
+			tool:    "get_section",
+			args:    `{"url":"http://example.com/jobs","heading":"Retries"}`,
+			want:    []string{`heading "Retries" not found`, "available headings: Task Runner | Cancel a task"},
+			isError: true,
+		},
+		{tool: "list_sources", args: `{}`, want: []string{"[default] example.com (2 pages)"}},
+		{tool: "list_sources", args: `{"collection":"nosuch"}`, isError: true},
+		{
+			tool: "get_context",
+			args: `{"query":"abort","max_tokens":500}`,
+			want: []string{"## Task Runner > Cancel a task\nSource: http://example.com/jobs#cancel"},
+		},
+		{
+			tool: "get_context",
+			args: `{"query":"abort","max_tokens":-1}`, // the default budget
+			want: []string{"Call runner.Cancel(id) to abort a running task."},
+		},
+		{
+			tool: "get_context",
+			args: `{"query":"abort","max_tokens":5}`,
+			want: []string{`No section of the results for "abort" fits in 5 tokens`},
+		},
+		{tool: "get_document", args: `{"url":"http://example.com/jobs","collection":"nosuch"}`, isError: true},
+	}
+	for _, tt := range tests {
+		raw, errMsg := callMCP(t, "tools/call", `{"name":"`+tt.tool+`","arguments":`+tt.args+`}`)
+		if errMsg != "" {
+			t.Errorf("%s %s: %s", tt.tool, tt.args, errMsg)
+			continue
+		}
+		var res mcpToolResult
+		if err := json.Unmarshal(raw, &res); err != nil || len(res.Content) == 0 {
+			t.Errorf("%s %s: bad result %s", tt.tool, tt.args, raw)
+			continue
+		}
+		if res.IsError != tt.isError {
+			t.Errorf("%s %s: isError = %v, want %v: %s", tt.tool, tt.args, res.IsError, tt.isError, res.Content[0].Text)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(res.Content[0].Text, want) {
+				t.Errorf("%s %s: text\n%s\ndoes not contain %q", tt.tool, tt.args, res.Content[0].Text, want)
+			}
+		}
+	}
+}
+
+func TestMCPUnknownTool(t *testing.T) {
+	if _, errMsg := callMCP(t, "tools/call", `{"name":"nosuch"}`); errMsg != "unknown tool: nosuch" {
+		t.Errorf("error %q, want %q", errMsg, "unknown tool: nosuch")
+	}
+}
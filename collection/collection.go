@@ -0,0 +1,326 @@
+package collection
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/deepersensor/documcp/config"
+	"github.com/deepersensor/documcp/crawler"
+	"github.com/deepersensor/documcp/docstore"
+	"github.com/deepersensor/documcp/embed"
+	"github.com/deepersensor/documcp/index"
+)
+
+// DefaultName is the collection used when none is specified.
+const DefaultName = "default"
+
+// ErrNotFound is returned when a collection does not exist.
+var ErrNotFound = errors.New("collection not found")
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// ValidateName checks that name is usable as a collection directory name.
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid collection name %q: use lowercase letters, digits, '.', '_' or '-' (max 64)", name)
+	}
+	return nil
+}
+
+// Collection is a named index and document store, typically one per
+// documentation site.
+type Collection struct {
+	Name    string
+	Dir     string
+	Index   *index.InvertedIndex
+	Docs    *docstore.Store
+	Vectors *index.VectorIndex
+
+	embedder embed.Embedder
+	embedMu  sync.Mutex
+	saveMu   sync.Mutex
+	// mu is held to add or remove documents, and for reading by Save, so
+	// the files it writes agree with each other.
+	mu sync.RWMutex
+}
+
+// Save atomically persists the collection's index, docstore and vectors.
+// Documents cannot be added or removed meanwhile.
+func (c *Collection) Save() error {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if err := c.Index.Save(filepath.Join(c.Dir, config.IndexFileName)); err != nil {
+		return err
+	}
+	if err := c.Docs.Save(filepath.Join(c.Dir, config.DocStoreFileName)); err != nil {
+		return err
+	}
+	return c.Vectors.Save(filepath.Join(c.Dir, config.VectorsFileName))
+}
+
+// AddResults adds crawl results to the collection's index and document store
+// and returns the number of pages indexed. Each page is indexed whole and
+// section by section, under IDs derived from its URL and the sections'
+// anchors, so a page crawled again keeps its IDs. A page crawled before is
+// replaced: it gains a version if its content changed, and its old sections
+// are removed. The new documents get vectors on the next call to Embed.
+func (c *Collection) AddResults(results []crawler.CrawlResult) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, res := range results {
+		docID := index.DocID(res.URL)
+		version := 1
+		if prev, ok := c.Docs.Get(docID); ok {
+			c.removeSections(prev)
+			c.Vectors.Remove(docID)
+			version = prev.Version
+			if prev.Title != res.Title || prev.Text != res.Text || !slices.Equal(prev.CodeSnippets, res.Code) {
+				version++
+			}
+		}
+		page := docstore.NewDocument(docID, res.URL, res.Title, res.Text, res.Headings, res.Code, nil, version)
+		anchors := make([]string, len(res.Sections))
+		for i, s := range res.Sections {
+			anchors[i] = s.Anchor
+		}
+		sectionIDs := sectionIDs(res.URL, anchors)
+		for i, s := range res.Sections {
+			sectionURL := res.URL
+			if s.Anchor != "" {
+				sectionURL += "#" + s.Anchor
+			}
+			// Sections carry the page title and their heading path, so a
+			// query naming the page and the topic finds the section.
+			section := docstore.NewDocument(sectionIDs[i], sectionURL, res.Title, s.Text, nil, s.Code, nil, version)
+			section.ParentID = docID
+			section.Path = s.Path
+			c.put(section)
+			page.Sections = append(page.Sections, sectionIDs[i])
+		}
+		c.put(page)
+	}
+	return len(results)
+}
+
+// put stores a document and indexes it.
+func (c *Collection) put(d *docstore.Document) {
+	c.Docs.Put(d)
+	c.Index.Put(d)
+}
+
+// sectionIDs returns the IDs of the sections of a page, given their
+// anchors in page order. Pages can repeat an anchor, so repeats are told
+// apart by the number of times it occurred before.
+func sectionIDs(pageURL string, anchors []string) []string {
+	ids := make([]string, len(anchors))
+	seen := make(map[string]int, len(anchors))
+	for i, a := range anchors {
+		key := a
+		if n := seen[a]; n > 0 {
+			key = fmt.Sprintf("%s~%d", a, n)
+		}
+		seen[a]++
+		ids[i] = index.SectionID(pageURL, key)
+	}
+	return ids
+}
+
+// RemovePage removes a page and its sections, given the page's ID, and
+// reports whether there was such a page.
+func (c *Collection) RemovePage(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.Docs.Get(id)
+	if !ok || d.IsSection() {
+		return false
+	}
+	c.removePage(d)
+	return true
+}
+
+// RemoveURL removes the page with the given URL and its sections, and
+// returns the number of pages removed.
+func (c *Collection) RemoveURL(url string) int {
+	if c.RemovePage(index.DocID(url)) {
+		return 1
+	}
+	return 0
+}
+
+// removePage deletes a page and its sections from the index, docstore and
+// vectors.
+func (c *Collection) removePage(page *docstore.Document) {
+	c.removeSections(page)
+	c.Index.RemoveDocument(page.ID)
+	c.Docs.Delete(page.ID)
+	c.Vectors.Remove(page.ID)
+}
+
+// removeSections deletes a page's sections from the index, docstore and
+// vectors.
+func (c *Collection) removeSections(page *docstore.Document) {
+	for _, id := range page.Sections {
+		c.Index.RemoveDocument(id)
+		c.Docs.Delete(id)
+		c.Vectors.Remove(id)
+	}
+}
+
+// load reads a collection from dir; missing files yield empty stores. A new
+// collection indexes with analyzer; an existing one keeps the analyzer its
+// index was built with. Vectors from a model other than embedder's are
+// dropped, to be computed again by Embed.
+func load(name, dir string, ranking index.Ranking, analyzer *index.Analyzer, embedder embed.Embedder, hnsw index.HNSWParams) (*Collection, error) {
+	ds, err := docstore.LoadStore(filepath.Join(dir, config.DocStoreFileName))
+	if err != nil {
+		return nil, err
+	}
+	idx, err := index.LoadInvertedIndex(filepath.Join(dir, config.IndexFileName), analyzer, ds)
+	if err != nil {
+		return nil, err
+	}
+	idx.SetRanking(ranking)
+	vecs, err := index.LoadVectorIndex(filepath.Join(dir, config.VectorsFileName), embedder.Name(), hnsw)
+	if err != nil {
+		return nil, err
+	}
+	return &Collection{Name: name, Dir: dir, Index: idx, Docs: ds, Vectors: vecs, embedder: embedder}, nil
+}
+
+// Manager opens, lists and manages the collections stored under the indexes
+// directory, one subdirectory per collection. Opened collections are cached
+// so every caller in the process shares the same in-memory stores.
+type Manager struct {
+	dir      string
+	ranking  index.Ranking
+	analyzer *index.Analyzer
+	embedder embed.Embedder
+	hnsw     index.HNSWParams
+	mu       sync.Mutex
+	open     map[string]*Collection
+}
+
+// NewManager creates a Manager for the given indexes directory. Every
+// collection it opens ranks results with the given parameters, computes
+// vectors with embedder and searches them with an HNSW graph tuned by
+// hnsw, and new collections are analyzed with analyzer.
+func NewManager(indexesDir string, ranking index.Ranking, analyzer *index.Analyzer, embedder embed.Embedder, hnsw index.HNSWParams) *Manager {
+	return &Manager{dir: indexesDir, ranking: ranking, analyzer: analyzer, embedder: embedder, hnsw: hnsw, open: make(map[string]*Collection)}
+}
+
+// Get returns an existing collection. The default collection always exists.
+func (m *Manager) Get(name string) (*Collection, error) {
+	return m.get(name, name == DefaultName)
+}
+
+// GetOrCreate returns the named collection, creating it if needed. New
+// collections are written to disk on their first Save.
+func (m *Manager) GetOrCreate(name string) (*Collection, error) {
+	return m.get(name, true)
+}
+
+func (m *Manager) get(name string, create bool) (*Collection, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.open[name]; ok {
+		return c, nil
+	}
+	dir := filepath.Join(m.dir, name)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) && !create {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	c, err := load(name, dir, m.ranking, m.analyzer, m.embedder, m.hnsw)
+	if err != nil {
+		return nil, err
+	}
+	m.open[name] = c
+	return c, nil
+}
+
+// List returns the names of all collections on disk or open in memory, sorted.
+func (m *Manager) List() ([]string, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	for _, e := range entries {
+		if e.IsDir() && ValidateName(e.Name()) == nil {
+			seen[e.Name()] = struct{}{}
+		}
+	}
+	m.mu.Lock()
+	for name := range m.open {
+		seen[name] = struct{}{}
+	}
+	m.mu.Unlock()
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Remove deletes a collection from disk and memory.
+func (m *Manager) Remove(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir := filepath.Join(m.dir, name)
+	_, open := m.open[name]
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) && !open {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	delete(m.open, name)
+	return os.RemoveAll(dir)
+}
+
+// Rename renames a collection on disk and in memory.
+func (m *Manager) Rename(oldName, newName string) error {
+	if err := ValidateName(oldName); err != nil {
+		return err
+	}
+	if err := ValidateName(newName); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldDir := filepath.Join(m.dir, oldName)
+	newDir := filepath.Join(m.dir, newName)
+	if _, err := os.Stat(newDir); err == nil {
+		return fmt.Errorf("collection already exists: %s", newName)
+	}
+	if _, ok := m.open[newName]; ok {
+		return fmt.Errorf("collection already exists: %s", newName)
+	}
+	c, open := m.open[oldName]
+	if _, err := os.Stat(oldDir); errors.Is(err, os.ErrNotExist) {
+		if !open {
+			return fmt.Errorf("%w: %s", ErrNotFound, oldName)
+		}
+	} else if err := os.Rename(oldDir, newDir); err != nil {
+		return err
+	}
+	if open {
+		c.saveMu.Lock()
+		c.Name, c.Dir = newName, newDir
+		c.saveMu.Unlock()
+		delete(m.open, oldName)
+		m.open[newName] = c
+	}
+	return nil
+}
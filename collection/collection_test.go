@@ -0,0 +1,296 @@
+package collection
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/deepersensor/documcp/collection/collectiontest"
+	"github.com/deepersensor/documcp/crawler"
+
+	"github.com/deepersensor/documcp/embed"
+	"github.com/deepersensor/documcp/index"
+)
+
+// countingEmbedder records the number of texts it is asked to embed.
+type countingEmbedder struct {
+	embed.Embedder
+	texts int
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.texts += len(texts)
+	return e.Embedder.Embed(ctx, texts)
+}
+
+// newTestCollection returns an empty collection in a temporary directory,
+// using the hash embedder if embedder is nil.
+func newTestCollection(t *testing.T, embedder embed.Embedder) *Collection {
+	t.Helper()
+	analyzer, err := index.NewAnalyzer(index.DefaultAnalyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if embedder == nil {
+		embedder = embed.NewHashEmbedder(embed.DefaultHashDim, analyzer)
+	}
+	c, err := load("test", t.TempDir(), index.DefaultRanking(), analyzer, embedder, index.DefaultHNSWParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// indexHits returns the URLs of the index entries matching query, so tests
+// can see duplicates that Search would merge.
+func indexHits(t *testing.T, c *Collection, query string) []string {
+	t.Helper()
+	results, err := c.Index.Search(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, r := range results {
+		urls = append(urls, r.URL)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// staleIDs returns the sorted IDs that have postings in the index but no
+// document in the docstore.
+func staleIDs(c *Collection) []string {
+	var ids []string
+	for _, postings := range c.Index.Index {
+		for id := range postings {
+			if _, ok := c.Docs.Get(id); !ok && !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestRecrawlReplacesPage(t *testing.T) {
+	c := newTestCollection(t, nil)
+	c.AddResults(collectiontest.Pages)
+	jobs, _ := c.Docs.Get(index.DocID("http://example.com/jobs"))
+
+	recrawl := collectiontest.Pages[0]
+	recrawl.Text = "Task Runner\nStop a task\nCall runner.Stop(id) to abort a running task."
+	recrawl.Headings = []string{"Task Runner", "Stop a task"}
+	recrawl.Sections = []crawler.Section{
+		{Heading: "Task Runner", Level: 1, Path: []string{"Task Runner"}, Anchor: "task-runner"},
+		{Heading: "Stop a task", Level: 2, Path: []string{"Task Runner", "Stop a task"}, Anchor: "stop", Text: "Call runner.Stop(id) to abort a running task."},
+	}
+	c.AddResults([]crawler.CrawlResult{recrawl})
+	c.AddResults([]crawler.CrawlResult{recrawl}) // unchanged the second time
+
+	if ids := staleIDs(c); len(ids) != 0 {
+		t.Fatalf("postings for %q after recrawls, which are not stored", ids)
+	}
+	page, ok := c.Docs.Get(jobs.ID)
+	if !ok {
+		t.Fatal("recrawled page is missing")
+	}
+	if page.ID != jobs.ID || page.Version != 2 {
+		t.Errorf("recrawled page is %s version %d, want %s version 2", page.ID, page.Version, jobs.ID)
+	}
+	if c.Docs.Len() != 4 {
+		t.Errorf("docstore holds %d documents, want 2 pages and 2 sections", c.Docs.Len())
+	}
+	for _, id := range jobs.Sections {
+		if _, ok := c.Docs.Get(id); ok && !slices.Contains(page.Sections, id) {
+			t.Errorf("old section %s is still stored", id)
+		}
+	}
+	tests := []struct {
+		query, want string // index entries' URLs, sorted
+	}{
+		{"abort", "http://example.com/jobs http://example.com/jobs#stop"},
+		{"stop", "http://example.com/jobs http://example.com/jobs#stop"},
+		{"cancel", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(indexHits(t, c, tt.query), " "); got != tt.want {
+			t.Errorf("index hits for %q = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+	hits, total, err := c.Search(context.Background(), "abort", SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || hits[0].Doc.ID != jobs.ID || hits[0].Section == nil || hits[0].Section.URL != "http://example.com/jobs#stop" {
+		t.Errorf("Search(abort) = %d hits %+v, want the page once with its new section", total, hits)
+	}
+}
+
+func TestRemoveURL(t *testing.T) {
+	c := newTestCollection(t, nil)
+	c.AddResults(collectiontest.Pages)
+	if _, err := c.Embed(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	jobs, _ := c.Docs.Get(index.DocID("http://example.com/jobs"))
+	removed := append([]string{jobs.ID}, jobs.Sections...)
+
+	if n := c.RemoveURL("http://example.com/jobs"); n != 1 {
+		t.Fatalf("RemoveURL removed %d pages, want 1", n)
+	}
+	for _, id := range removed {
+		if _, ok := c.Docs.Get(id); ok {
+			t.Errorf("%s is still in the docstore", id)
+		}
+		if c.Vectors.Has(id) {
+			t.Errorf("%s still has a vector", id)
+		}
+	}
+	if ids := staleIDs(c); len(ids) != 0 {
+		t.Errorf("postings for removed documents %q", ids)
+	}
+	for _, query := range []string{"abort", "runner", "task"} {
+		if got := indexHits(t, c, query); len(got) != 0 {
+			t.Errorf("index hits for %q = %q after removal, want none", query, got)
+		}
+		if postings := c.Index.Index[query]; len(postings) != 0 {
+			t.Errorf("term %q still has postings %v", query, postings)
+		}
+	}
+	if got := strings.Join(indexHits(t, c, "installer"), " "); got != "http://example.com/install" {
+		t.Errorf("index hits for installer = %q, want the install page", got)
+	}
+}
+
+func TestRemoveUnknownURL(t *testing.T) {
+	c := newTestCollection(t, nil)
+	c.AddResults(collectiontest.Pages)
+	if _, err := c.Embed(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	docs, vectors := c.Docs.Len(), c.Vectors.Len()
+	for _, url := range []string{"http://example.com/nosuch", "http://example.com/jobs#cancel", ""} {
+		if n := c.RemoveURL(url); n != 0 {
+			t.Errorf("RemoveURL(%q) removed %d pages, want 0", url, n)
+		}
+	}
+	if c.RemovePage("nosuch") {
+		t.Error("RemovePage(nosuch) reported a removal")
+	}
+	if c.Docs.Len() != docs || c.Vectors.Len() != vectors {
+		t.Errorf("%d documents and %d vectors after no-op removals, want %d and %d", c.Docs.Len(), c.Vectors.Len(), docs, vectors)
+	}
+}
+
+func TestIDsStable(t *testing.T) {
+	dir := t.TempDir()
+	analyzer, err := index.NewAnalyzer(index.DefaultAnalyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := func() *Collection {
+		c, err := load("test", dir, index.DefaultRanking(), analyzer, embed.NewHashEmbedder(embed.DefaultHashDim, analyzer), index.DefaultHNSWParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	c := open()
+	c.AddResults(collectiontest.Pages)
+	jobs, ok := c.Docs.Get(index.DocID("http://example.com/jobs"))
+	if !ok {
+		t.Fatal("page is not stored under the ID of its URL")
+	}
+	want := append([]string{jobs.ID}, jobs.Sections...)
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	c = open()
+	recrawl := collectiontest.Pages[0]
+	recrawl.URL = "HTTP://Example.com:80/jobs"
+	recrawl.Sections = slices.Clone(recrawl.Sections)
+	recrawl.Sections[1].Text = "Call runner.Cancel(id) to stop a running task."
+	c.AddResults([]crawler.CrawlResult{recrawl})
+
+	page, ok := c.Docs.Get(jobs.ID)
+	if !ok {
+		t.Fatal("page ID changed across save, load and recrawl")
+	}
+	if got := append([]string{page.ID}, page.Sections...); !slices.Equal(got, want) {
+		t.Errorf("IDs after save, load and recrawl = %q, want %q", got, want)
+	}
+	if c.Docs.Len() != 4 {
+		t.Errorf("docstore holds %d documents, want 2 pages and 2 sections", c.Docs.Len())
+	}
+}
+
+func TestSectionIDs(t *testing.T) {
+	page := "http://example.com/jobs"
+	tests := []struct {
+		name    string
+		anchors []string
+		want    []string
+	}{
+		{"distinct", []string{"intro", "cancel"}, []string{index.SectionID(page, "intro"), index.SectionID(page, "cancel")}},
+		{"repeated", []string{"example", "example", "example"}, []string{
+			index.SectionID(page, "example"), index.SectionID(page, "example~1"), index.SectionID(page, "example~2"),
+		}},
+		{"no anchor", []string{"", "cancel", ""}, []string{
+			index.SectionID(page, ""), index.SectionID(page, "cancel"), index.SectionID(page, "~1"),
+		}},
+	}
+	for _, tt := range tests {
+		if got := sectionIDs(page, tt.anchors); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: sectionIDs(%q) = %q, want %q", tt.name, tt.anchors, got, tt.want)
+		}
+	}
+	// Adding a section after the others leaves the earlier IDs alone.
+	before := sectionIDs(page, []string{"intro", "example", "example"})
+	after := sectionIDs(page, []string{"intro", "example", "example", "cancel"})
+	if !slices.Equal(after[:3], before) {
+		t.Errorf("sectionIDs changed from %q to %q when a section was appended", before, after[:3])
+	}
+}
+
+func TestVectorSearchEmbedsOnlyQuery(t *testing.T) {
+	analyzer, err := index.NewAnalyzer(index.DefaultAnalyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &countingEmbedder{Embedder: embed.NewHashEmbedder(embed.DefaultHashDim, analyzer)}
+	c := newTestCollection(t, e)
+	c.AddResults(collectiontest.Pages)
+	if e.texts != 0 {
+		t.Fatalf("AddResults embedded %d texts, want 0 before Embed", e.texts)
+	}
+	n, err := c.Embed(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("Embed embedded %d documents, want the 2 sections and the page without sections", n)
+	}
+	e.texts = 0
+	hits, _, err := c.Search(context.Background(), "aborting running tasks", SearchOptions{Mode: ModeVector})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.texts != 1 {
+		t.Errorf("vector search embedded %d texts, want only the query", e.texts)
+	}
+	if len(hits) == 0 || hits[0].Doc.URL != "http://example.com/jobs" {
+		t.Errorf("vector search found %v, want the jobs page first", hits)
+	}
+}
+
+func TestVectorSearchBeforeEmbed(t *testing.T) {
+	c := newTestCollection(t, nil)
+	c.AddResults(collectiontest.Pages)
+	hits, total, err := c.Search(context.Background(), "cancel a task", SearchOptions{Mode: ModeVector})
+	if err != nil || total != 0 || len(hits) != 0 {
+		t.Errorf("vector search before Embed = %v, %d, %v; want no hits", hits, total, err)
+	}
+}
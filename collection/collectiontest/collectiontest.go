@@ -0,0 +1,23 @@
+package collectiontest
+
+import "github.com/deepersensor/documcp/crawler"
+
+// Pages are two crawled pages shared by the collection and API tests. The
+// first is split into sections; the second has none.
+var Pages = []crawler.CrawlResult{
+	{
+		URL:      "http://example.com/jobs",
+		Title:    "Task Runner",
+		Text:     "Task Runner\nCancel a task\nCall runner.Cancel(id) to abort a running task.",
+		Headings: []string{"Task Runner", "Cancel a task"},
+		Sections: []crawler.Section{
+			{Heading: "Task Runner", Level: 1, Path: []string{"Task Runner"}, Anchor: "task-runner"},
+			{Heading: "Cancel a task", Level: 2, Path: []string{"Task Runner", "Cancel a task"}, Anchor: "cancel", Text: "Call runner.Cancel(id) to abort a running task."},
+		},
+	},
+	{
+		URL:   "http://example.com/install",
+		Title: "Install",
+		Text:  "Run the installer and configure the connection pool.",
+	},
+}
@@ -0,0 +1,141 @@
+package collection
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deepersensor/documcp/docstore"
+	"github.com/deepersensor/documcp/embed"
+	"github.com/deepersensor/documcp/index"
+)
+
+// newTestManager returns a Manager over a temporary directory holding the
+// named collections, each saved with one document.
+func newTestManager(t *testing.T, names ...string) *Manager {
+	t.Helper()
+	analyzer, err := index.NewAnalyzer(index.DefaultAnalyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(t.TempDir(), index.DefaultRanking(), analyzer, embed.NewHashEmbedder(embed.DefaultHashDim, analyzer), index.DefaultHNSWParams)
+	for _, name := range names {
+		c, err := m.GetOrCreate(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		url := "http://" + name + ".example.com/"
+		d := docstore.NewDocument(index.DocID(url), url, "", "Text of "+name, nil, nil, nil, 1)
+		c.Docs.Put(d)
+		c.Index.Put(d)
+		if err := c.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestManagerList(t *testing.T) {
+	m := newTestManager(t, "zeta", "alpha", DefaultName)
+	if _, err := m.GetOrCreate("beta"); err != nil { // open but never saved
+		t.Fatal(err)
+	}
+	// Neither stray files nor directories with invalid names are collections.
+	os.WriteFile(filepath.Join(m.dir, "notes.txt"), nil, 0o644)
+	os.Mkdir(filepath.Join(m.dir, "Not A Name"), 0o755)
+
+	names, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(names, " "), "alpha beta default zeta"; got != want {
+		t.Errorf("List() = %q, want %q", got, want)
+	}
+}
+
+func TestManagerRename(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		wantErr  string // "" for success
+	}{
+		{name: "onto an existing collection", old: "alpha", new: "beta", wantErr: "collection already exists: beta"},
+		{name: "onto an open collection", old: "alpha", new: "gamma", wantErr: "collection already exists: gamma"},
+		{name: "unknown collection", old: "nosuch", new: "delta", wantErr: "collection not found: nosuch"},
+		{name: "invalid name", old: "alpha", new: "Bad Name", wantErr: "invalid collection name"},
+		{name: "success", old: "alpha", new: "delta"},
+	}
+	for _, tt := range tests {
+		m := newTestManager(t, "alpha", "beta")
+		if _, err := m.GetOrCreate("gamma"); err != nil {
+			t.Fatal(err)
+		}
+		err := m.Rename(tt.old, tt.new)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: Rename(%q, %q) = %v, want %q", tt.name, tt.old, tt.new, err, tt.wantErr)
+			}
+			if c, err := m.Get("alpha"); err != nil || c.Docs.Len() != 1 {
+				t.Errorf("%s: failed rename changed alpha: %v", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if _, err := m.Get(tt.old); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Get(%q) after rename = %v, want ErrNotFound", tt.name, tt.old, err)
+		}
+		c, err := m.Get(tt.new)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if c.Name != tt.new || c.Dir != filepath.Join(m.dir, tt.new) || c.Docs.Len() != 1 {
+			t.Errorf("%s: renamed collection is %q in %s with %d documents", tt.name, c.Name, c.Dir, c.Docs.Len())
+		}
+	}
+}
+
+func TestManagerRemove(t *testing.T) {
+	tests := []struct {
+		name    string
+		remove  string
+		wantErr error
+	}{
+		{name: "saved collection", remove: "alpha"},
+		{name: "default collection", remove: DefaultName},
+		{name: "unknown collection", remove: "nosuch", wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		m := newTestManager(t, "alpha", DefaultName)
+		err := m.Remove(tt.remove)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Remove(%q) = %v, want %v", tt.name, tt.remove, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(m.dir, tt.remove)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: directory still exists after Remove: %v", tt.name, err)
+		}
+		names, _ := m.List()
+		for _, n := range names {
+			if n == tt.remove {
+				t.Errorf("%s: List() still has %q", tt.name, n)
+			}
+		}
+		// The default collection always exists, but comes back empty.
+		c, err := m.Get(tt.remove)
+		if tt.remove == DefaultName {
+			if err != nil || c.Docs.Len() != 0 {
+				t.Errorf("%s: Get after Remove = %v, %v; want an empty collection", tt.name, c, err)
+			}
+		} else if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Get after Remove = %v, want ErrNotFound", tt.name, err)
+		}
+	}
+}
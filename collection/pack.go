@@ -0,0 +1,159 @@
+package collection
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/deepersensor/documcp/docstore"
+	"github.com/deepersensor/documcp/index"
+)
+
+// minChunkTokens is the smallest budget worth filling with a cut-down chunk.
+const minChunkTokens = 32
+
+// Chunk is a section, or a page without sections, packed into a context.
+type Chunk struct {
+	ID        string   // section or page ID
+	PageID    string   // ID of the page the chunk comes from
+	URL       string   // source URL, with the section's anchor
+	Title     string   // page title
+	Path      []string // heading path of a section
+	Text      string
+	Score     float64
+	Tokens    int  // estimated tokens of the rendered chunk
+	Truncated bool // Text was cut down to its best matching passage to fit
+}
+
+// Render formats the chunk for a language model: a heading naming the page
+// and section, the source URL and the text.
+func (ch Chunk) Render() string {
+	heading := ch.Title
+	if heading == "" {
+		heading = ch.URL
+	}
+	path := ch.Path
+	if len(path) > 0 && strings.EqualFold(path[0], ch.Title) {
+		path = path[1:] // the page's top heading usually repeats its title
+	}
+	if len(path) > 0 {
+		heading += " > " + strings.Join(path, " > ")
+	}
+	return fmt.Sprintf("## %s\nSource: %s\n\n%s\n", heading, ch.URL, ch.Text)
+}
+
+// ContextPack is the set of chunks that best answer a query within a token
+// budget.
+type ContextPack struct {
+	Query   string
+	Budget  int
+	Tokens  int // estimated tokens used by the chunks
+	Chunks  []Chunk
+	Omitted int // matching chunks left out for lack of room
+}
+
+// String renders the chunks in order, separated by blank lines.
+func (p *ContextPack) String() string {
+	parts := make([]string, len(p.Chunks))
+	for i, ch := range p.Chunks {
+		parts[i] = ch.Render()
+	}
+	return strings.Join(parts, "\n")
+}
+
+// PackOptions controls PackContext.
+type PackOptions struct {
+	Budget int    // tokens the chunks may take up together
+	Mode   string // search mode; ModeLexical if empty
+	// Filter, if set, leaves out pages for which it returns false.
+	Filter func(page *docstore.Document) bool
+}
+
+// PackContext returns the chunks best matching the query, most relevant
+// first, that fit in the token budget together. Chunks are the sections of
+// matching pages, or whole pages for pages indexed without sections or
+// matching only as a whole. Chunks with the same text, such as navigation
+// repeated on every page, are included once. When the next chunk does not
+// fit, it is cut down to its passage best matching the query if enough of
+// the budget is left, and smaller chunks after it may still be packed.
+func (c *Collection) PackContext(ctx context.Context, query string, opts PackOptions) (*ContextPack, error) {
+	budget := opts.Budget
+	if budget < 1 {
+		return nil, fmt.Errorf("%w: token budget must be positive", ErrInvalidOption)
+	}
+	results, err := c.rank(ctx, query, opts.Mode, vectorCandidates)
+	if err != nil {
+		return nil, err
+	}
+	// Pages with matching sections are represented by those sections.
+	sectionHits := make(map[string]bool)
+	for _, r := range results {
+		if d, ok := c.Docs.Get(r.ID); ok && d.IsSection() {
+			sectionHits[d.ParentID] = true
+		}
+	}
+	pack := &ContextPack{Query: query, Budget: budget}
+	seen := make(map[string]bool)
+	for _, r := range results {
+		d, ok := c.Docs.Get(r.ID)
+		if !ok || !d.IsSection() && sectionHits[d.ID] {
+			continue
+		}
+		page := d
+		if d.IsSection() {
+			if page, ok = c.Docs.Get(d.ParentID); !ok {
+				continue
+			}
+		}
+		if opts.Filter != nil && !opts.Filter(page) {
+			continue
+		}
+		key := strings.Join(strings.Fields(strings.ToLower(d.Text)), " ")
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		ch := Chunk{ID: d.ID, PageID: page.ID, URL: d.URL, Title: page.Title, Path: d.Path, Text: d.Text, Score: r.Score}
+		ch.Tokens = EstimateTokens(ch.Render())
+		left := budget - pack.Tokens
+		if ch.Tokens > left {
+			header := EstimateTokens(Chunk{URL: ch.URL, Title: ch.Title, Path: ch.Path}.Render())
+			if left-header < minChunkTokens {
+				pack.Omitted++
+				continue
+			}
+			// Snippet lengths are in bytes; shrink until the estimate fits.
+			for length := (left - header) * 4; length > 0; length = length * 9 / 10 {
+				ch.Text = c.Index.Highlighter(query, index.SnippetOptions{Length: length}).Snippet(d.Text)
+				if ch.Tokens = EstimateTokens(ch.Render()); ch.Tokens <= left {
+					break
+				}
+			}
+			if ch.Tokens > left {
+				pack.Omitted++
+				continue
+			}
+			ch.Truncated = true
+		}
+		pack.Chunks = append(pack.Chunks, ch)
+		pack.Tokens += ch.Tokens
+	}
+	return pack, nil
+}
+
+// EstimateTokens approximates the number of tokens a language model reads
+// for s: about four characters per token for alphabetic scripts, and one
+// per character for Chinese and Japanese.
+func EstimateTokens(s string) int {
+	var chars, cjk int
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) {
+			cjk++
+		} else {
+			chars++
+		}
+	}
+	return (chars+3)/4 + cjk
+}
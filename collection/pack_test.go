@@ -0,0 +1,144 @@
+package collection
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/deepersensor/documcp/collection/collectiontest"
+	"github.com/deepersensor/documcp/crawler"
+	"github.com/deepersensor/documcp/docstore"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"東京都", 3},
+		{"see 東京", 3},
+		{strings.Repeat("word ", 100), 125},
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.s); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestChunkRender(t *testing.T) {
+	tests := []struct {
+		chunk Chunk
+		want  string
+	}{
+		{
+			Chunk{URL: "http://example.com/jobs#cancel", Title: "Task Runner", Path: []string{"Task Runner", "Cancel a task"}, Text: "Call Cancel."},
+			"## Task Runner > Cancel a task\nSource: http://example.com/jobs#cancel\n\nCall Cancel.\n",
+		},
+		{
+			Chunk{URL: "http://example.com/jobs#api", Title: "Task Runner", Path: []string{"API", "Cancel"}, Text: "x"},
+			"## Task Runner > API > Cancel\nSource: http://example.com/jobs#api\n\nx\n",
+		},
+		{
+			Chunk{URL: "http://example.com/install", Text: "Run it."},
+			"## http://example.com/install\nSource: http://example.com/install\n\nRun it.\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.chunk.Render(); got != tt.want {
+			t.Errorf("Render() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestPackContext(t *testing.T) {
+	c := newTestCollection(t, nil)
+	c.AddResults(collectiontest.Pages)
+	long := strings.Repeat("Filler text about nothing in particular. ", 200)
+	c.AddResults([]crawler.CrawlResult{
+		{URL: "http://example.com/faq", Title: "FAQ", Text: "Footer: report a bug with the task tracker."},
+		{URL: "http://example.com/about", Title: "About", Text: "Footer: report a bug with the task tracker."},
+		{URL: "http://example.com/long", Title: "Long", Text: long + "The needle is here. " + long},
+	})
+
+	tests := []struct {
+		name      string
+		query     string
+		opts      PackOptions
+		urls      string // chunk URLs in order, or "" for none
+		omitted   int
+		truncated bool
+	}{
+		{
+			name:  "sections stand for their page",
+			query: "abort",
+			opts:  PackOptions{Budget: 1000},
+			urls:  "http://example.com/jobs#cancel",
+		},
+		{
+			name:  "pages without sections are whole chunks",
+			query: "installer",
+			opts:  PackOptions{Budget: 1000},
+			urls:  "http://example.com/install",
+		},
+		{
+			name:  "duplicate text is packed once",
+			query: "tracker",
+			opts:  PackOptions{Budget: 1000},
+			urls:  "http://example.com/about",
+		},
+		{
+			name:    "chunks that do not fit are omitted",
+			query:   "tracker OR installer",
+			opts:    PackOptions{Budget: 20},
+			omitted: 2,
+		},
+		{
+			name:      "long chunks are cut down to the best passage",
+			query:     "needle",
+			opts:      PackOptions{Budget: 100},
+			urls:      "http://example.com/long",
+			truncated: true,
+		},
+		{
+			name:  "filter",
+			query: "tracker OR installer",
+			opts: PackOptions{Budget: 1000, Filter: func(page *docstore.Document) bool {
+				return page.URL != "http://example.com/install"
+			}},
+			urls: "http://example.com/about",
+		},
+	}
+	for _, tt := range tests {
+		pack, err := c.PackContext(context.Background(), tt.query, tt.opts)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var urls []string
+		truncated := false
+		for _, ch := range pack.Chunks {
+			urls = append(urls, ch.URL)
+			truncated = truncated || ch.Truncated
+			if ch.Truncated && !strings.Contains(ch.Text, tt.query) {
+				t.Errorf("%s: cut-down chunk %q lost the match", tt.name, ch.Text)
+			}
+		}
+		if got := strings.Join(urls, " "); got != tt.urls {
+			t.Errorf("%s: chunks %q, want %q", tt.name, got, tt.urls)
+		}
+		if pack.Omitted != tt.omitted || truncated != tt.truncated {
+			t.Errorf("%s: omitted %d, truncated %v; want %d, %v", tt.name, pack.Omitted, truncated, tt.omitted, tt.truncated)
+		}
+		if pack.Tokens > tt.opts.Budget {
+			t.Errorf("%s: %d tokens exceed the budget of %d", tt.name, pack.Tokens, tt.opts.Budget)
+		}
+	}
+
+	if _, err := c.PackContext(context.Background(), "task", PackOptions{}); err == nil {
+		t.Error("zero budget: PackContext succeeded, want an error")
+	}
+}
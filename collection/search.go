@@ -0,0 +1,198 @@
+package collection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/deepersensor/documcp/docstore"
+	"github.com/deepersensor/documcp/index"
+)
+
+// Result orders accepted by Search.
+const (
+	SortRelevance = "relevance"
+	SortURL       = "url"
+	SortTitle     = "title"
+)
+
+// Search modes accepted by Search.
+const (
+	ModeLexical = "lexical" // the query language over the inverted index
+	ModeVector  = "vector"  // similarity of embedding vectors
+	ModeHybrid  = "hybrid"  // both, merged by reciprocal rank fusion
+)
+
+// DefaultLimit is the number of results a search shows when the caller does
+// not choose one.
+const DefaultLimit = 20
+
+const (
+	// suggestMaxTotal is the largest number of results for which a search
+	// also offers "did you mean" corrections; finding them scans the
+	// vocabulary, and a query with many results is unlikely to be misspelt.
+	suggestMaxTotal = 3
+	// vectorCandidates is the least number of nearest documents a vector
+	// search returns.
+	vectorCandidates = 100
+	// rrfK damps the lead of top ranks in reciprocal rank fusion; 60 is the
+	// usual choice.
+	rrfK = 60
+)
+
+var (
+	// ErrInvalidOption is returned by Search and PackContext for options
+	// they do not accept, such as an unknown mode or sort order.
+	ErrInvalidOption = errors.New("invalid search option")
+	// ErrEmbedder is returned by Search and PackContext when the embedder
+	// fails to embed the query of a vector or hybrid search.
+	ErrEmbedder = errors.New("embedder failed")
+)
+
+// SearchOptions selects one page of search results.
+type SearchOptions struct {
+	Offset int
+	Limit  int    // 0 returns every result from Offset on
+	Sort   string // SortRelevance if empty
+	Mode   string // ModeLexical if empty
+	// Filter, if set, leaves out pages for which it returns false.
+	Filter func(page *docstore.Document) bool
+}
+
+// Hit is a page matching a search and its relevance score. Section is the
+// page's best matching section, or nil if the query only matches the page
+// as a whole. Scores are BM25 scores in lexical mode, cosine similarities
+// in vector mode and fused reciprocal ranks in hybrid mode.
+type Hit struct {
+	Doc     *docstore.Document
+	Section *docstore.Document
+	Score   float64
+}
+
+// Suggest returns corrections of a query that found total results, or nil
+// if it found enough not to need them.
+func (c *Collection) Suggest(query string, total int) []string {
+	if total > suggestMaxTotal {
+		return nil
+	}
+	return c.Index.Suggest(query)
+}
+
+// Search runs a query and returns the requested page of matching pages
+// together with the total number of matches. Each page appears once, with
+// the best of its own and its sections' scores. Query syntax errors are
+// returned as *index.SyntaxError, invalid options wrap ErrInvalidOption and
+// embedder failures wrap ErrEmbedder. Vector search only considers the nearest
+// documents, at least vectorCandidates of them, so its total is capped.
+func (c *Collection) Search(ctx context.Context, query string, opts SearchOptions) ([]Hit, int, error) {
+	var less func(a, b Hit) bool
+	switch opts.Sort {
+	case "", SortRelevance:
+	case SortURL:
+		less = func(a, b Hit) bool { return a.Doc.URL < b.Doc.URL }
+	case SortTitle:
+		less = func(a, b Hit) bool {
+			return strings.ToLower(a.Doc.Title) < strings.ToLower(b.Doc.Title)
+		}
+	default:
+		return nil, 0, fmt.Errorf("%w: unknown sort order %q (want %s, %s or %s)", ErrInvalidOption, opts.Sort, SortRelevance, SortURL, SortTitle)
+	}
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return nil, 0, fmt.Errorf("%w: offset and limit must not be negative", ErrInvalidOption)
+	}
+	results, err := c.rank(ctx, query, opts.Mode, max(vectorCandidates, 2*(opts.Offset+opts.Limit)))
+	if err != nil {
+		return nil, 0, err
+	}
+	hits := make([]Hit, 0, len(results))
+	byPage := make(map[string]int) // page ID -> index in hits
+	for _, r := range results {
+		d, ok := c.Docs.Get(r.ID)
+		if !ok {
+			continue
+		}
+		var section *docstore.Document
+		if d.IsSection() {
+			section = d
+			if d, ok = c.Docs.Get(section.ParentID); !ok {
+				continue
+			}
+		}
+		if opts.Filter != nil && !opts.Filter(d) {
+			continue
+		}
+		// Results come best first, so the first section seen is the best.
+		i, seen := byPage[d.ID]
+		if !seen {
+			byPage[d.ID] = len(hits)
+			hits = append(hits, Hit{Doc: d, Section: section, Score: r.Score})
+			continue
+		}
+		if hits[i].Section == nil && section != nil {
+			hits[i].Section = section
+		}
+	}
+	if less != nil {
+		// Stable, so equal keys stay in relevance order.
+		sort.SliceStable(hits, func(i, j int) bool { return less(hits[i], hits[j]) })
+	}
+	total := len(hits)
+	hits = hits[min(opts.Offset, total):]
+	if opts.Limit > 0 && len(hits) > opts.Limit {
+		hits = hits[:opts.Limit]
+	}
+	return hits, total, nil
+}
+
+// rank returns the documents matching the query in the given mode, best
+// first. Vector search returns the k nearest documents.
+func (c *Collection) rank(ctx context.Context, query, mode string, k int) ([]index.Neighbor, error) {
+	switch mode {
+	case "", ModeLexical:
+		results, err := c.Index.Search(query)
+		if err != nil {
+			return nil, err
+		}
+		ranked := make([]index.Neighbor, len(results))
+		for i, r := range results {
+			ranked[i] = index.Neighbor{ID: r.ID, Score: r.Score}
+		}
+		return ranked, nil
+	case ModeVector:
+		return c.searchVectors(ctx, query, k)
+	case ModeHybrid:
+		lexical, err := c.rank(ctx, query, ModeLexical, k)
+		if err != nil {
+			return nil, err
+		}
+		vector, err := c.rank(ctx, query, ModeVector, k)
+		if err != nil {
+			return nil, err
+		}
+		return fuse(lexical, vector), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown search mode %q (want %s, %s or %s)", ErrInvalidOption, mode, ModeLexical, ModeVector, ModeHybrid)
+	}
+}
+
+// fuse merges ranked lists by reciprocal rank fusion: each document scores
+// the sum of 1/(rrfK+rank) over the lists it appears in.
+func fuse(lists ...[]index.Neighbor) []index.Neighbor {
+	var fused []index.Neighbor
+	pos := make(map[string]int) // document ID -> index in fused
+	for _, list := range lists {
+		for rank, n := range list {
+			i, ok := pos[n.ID]
+			if !ok {
+				i = len(fused)
+				pos[n.ID] = i
+				fused = append(fused, index.Neighbor{ID: n.ID})
+			}
+			fused[i].Score += 1 / float64(rrfK+rank+1)
+		}
+	}
+	sort.SliceStable(fused, func(i, j int) bool { return fused[i].Score > fused[j].Score })
+	return fused
+}
@@ -0,0 +1,104 @@
+package collection
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/deepersensor/documcp/collection/collectiontest"
+	"github.com/deepersensor/documcp/index"
+)
+
+// neighbors returns a ranked list of the given IDs, best first.
+func neighbors(ids ...string) []index.Neighbor {
+	out := make([]index.Neighbor, len(ids))
+	for i, id := range ids {
+		out[i] = index.Neighbor{ID: id, Score: float64(len(ids) - i)}
+	}
+	return out
+}
+
+func TestFuse(t *testing.T) {
+	tests := []struct {
+		name            string
+		lexical, vector []index.Neighbor
+		want            string // IDs, best first
+	}{
+		{
+			name:    "documents in both lists come first",
+			lexical: neighbors("a", "b", "c"),
+			vector:  neighbors("c", "d", "a"),
+			want:    "a c b d",
+		},
+		{
+			name:    "lexical-only and vector-only documents interleave by rank",
+			lexical: neighbors("lex1", "lex2"),
+			vector:  neighbors("vec1", "vec2"),
+			want:    "lex1 vec1 lex2 vec2",
+		},
+		{
+			name:    "appearing in both lists outweighs one top rank",
+			lexical: neighbors("a", "b"),
+			vector:  neighbors("c", "b"),
+			want:    "b a c",
+		},
+		{
+			name:    "only lexical results",
+			lexical: neighbors("a", "b"),
+			want:    "a b",
+		},
+		{
+			name:   "only vector results",
+			vector: neighbors("a", "b"),
+			want:   "a b",
+		},
+		{name: "no results"},
+	}
+	for _, tt := range tests {
+		fused := fuse(tt.lexical, tt.vector)
+		ids := make([]string, len(fused))
+		for i, n := range fused {
+			ids[i] = n.ID
+			if i > 0 && n.Score > fused[i-1].Score {
+				t.Errorf("%s: scores not descending: %v", tt.name, fused)
+			}
+		}
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("%s: fuse = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFuseScores(t *testing.T) {
+	fused := fuse(neighbors("a", "b"), neighbors("b"))
+	want := map[string]float64{
+		"a": 1.0 / (rrfK + 1),
+		"b": 1.0/(rrfK+2) + 1.0/(rrfK+1),
+	}
+	for _, n := range fused {
+		if math.Abs(n.Score-want[n.ID]) > 1e-12 {
+			t.Errorf("score of %s = %v, want %v", n.ID, n.Score, want[n.ID])
+		}
+	}
+}
+
+func TestSuggestOnlyForFewResults(t *testing.T) {
+	c := newTestCollection(t, nil)
+	c.AddResults(collectiontest.Pages)
+	tests := []struct {
+		q     string
+		total int
+		want  string
+	}{
+		{"cancle", 0, "cancel"},
+		{"cancle", suggestMaxTotal, "cancel"},
+		{"cancle", suggestMaxTotal + 1, ""},
+		{"cancel", 0, ""},
+	}
+	for _, tt := range tests {
+		got := c.Suggest(tt.q, tt.total)
+		if tt.want == "" && len(got) > 0 || tt.want != "" && (len(got) == 0 || got[0] != tt.want) {
+			t.Errorf("Suggest(%q, %d) = %q, want %q", tt.q, tt.total, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package collection
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/deepersensor/documcp/docstore"
+	"github.com/deepersensor/documcp/index"
+)
+
+const (
+	// embedBatchSize is the number of texts sent to the embedder at once.
+	embedBatchSize = 32
+	// maxEmbedBytes caps the text embedded per document; embedding models
+	// only read so much.
+	maxEmbedBytes = 8000
+)
+
+// Embed computes vectors for the sections, and pages without sections, that
+// have none yet, and drops the vectors of documents no longer stored. It
+// returns the number of documents embedded. Vectors computed before an
+// error are kept. Crawls call it after adding their results, so documents
+// it missed, because the embedder failed or was changed, are embedded by
+// the next crawl of the collection.
+func (c *Collection) Embed(ctx context.Context) (int, error) {
+	c.embedMu.Lock()
+	defer c.embedMu.Unlock()
+	for _, id := range c.Vectors.IDs() {
+		if _, ok := c.Docs.Get(id); !ok {
+			c.Vectors.Remove(id)
+		}
+	}
+	var pending []*docstore.Document
+	for _, d := range c.Docs.All() {
+		if embeddable(d) && !c.Vectors.Has(d.ID) {
+			pending = append(pending, d)
+		}
+	}
+	done := 0
+	for len(pending) > 0 {
+		batch := pending[:min(embedBatchSize, len(pending))]
+		pending = pending[len(batch):]
+		texts := make([]string, len(batch))
+		for i, d := range batch {
+			texts[i] = c.embedText(d)
+		}
+		vecs, err := c.embedder.Embed(ctx, texts)
+		if err != nil {
+			return done, fmt.Errorf("embed %s: %w", c.Name, err)
+		}
+		for i, d := range batch {
+			// A document with no words has no direction; leave it out.
+			if c.Vectors.Add(d.ID, vecs[i]) == nil {
+				done++
+			}
+		}
+	}
+	return done, nil
+}
+
+// embeddable reports whether d is a unit of vector search: a section, or a
+// page that was not split into sections.
+func embeddable(d *docstore.Document) bool {
+	return d.IsSection() || len(d.Sections) == 0
+}
+
+// embedText is the text a document's vector is computed from: its title,
+// heading path and text.
+func (c *Collection) embedText(d *docstore.Document) string {
+	parts := []string{d.Title}
+	parts = append(parts, d.Path...)
+	parts = append(parts, d.Text)
+	text := strings.Join(parts, "\n")
+	if len(text) > maxEmbedBytes {
+		text = text[:maxEmbedBytes]
+		for !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+	}
+	return text
+}
+
+// searchVectors embeds the query and returns the k nearest documents that
+// are at all similar to it. Only documents embedded at index time are
+// found; searching never embeds the collection.
+func (c *Collection) searchVectors(ctx context.Context, query string, k int) ([]index.Neighbor, error) {
+	vecs, err := c.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("%w: embed query: %w", ErrEmbedder, err)
+	}
+	neighbors, err := c.Vectors.Search(vecs[0], k)
+	if err != nil {
+		return nil, err
+	}
+	for i, n := range neighbors {
+		if n.Score <= 0 {
+			return neighbors[:i], nil
+		}
+	}
+	return neighbors, nil
+}
@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -14,6 +17,9 @@ const (
 	IndexesDirName       = "indexes"
 	ConnectionsDirName   = "connections"
 	ProcessesDirName     = "processes"
+	IndexFileName        = "index.json"
+	DocStoreFileName     = "docstore.json"
+	VectorsFileName      = "vectors.json"
 	envPrefix            = "DOCUMCP_"
 )
 
@@ -21,9 +27,64 @@ const (
 type Config struct {
 	AppName string `json:"app_name"`
 	Version string `json:"version"`
+	// BM25K1 controls term frequency saturation in search ranking.
+	BM25K1 float64 `json:"bm25_k1"`
+	// BM25B controls document length normalisation (0 disables it, 1 is full).
+	BM25B float64 `json:"bm25_b"`
+	// FieldBoosts weights matches per field (title, heading, body, code).
+	FieldBoosts map[string]float64 `json:"field_boosts"`
+	// Analyzer is the text analysis chain for new collections: "english",
+	// "standard" or a comma-separated list of filters.
+	Analyzer string `json:"analyzer"`
+	// Embedder computes the vectors used by vector and hybrid search:
+	// "hash" (built in, offline) or "openai" (an OpenAI-compatible
+	// embeddings endpoint at EmbeddingURL).
+	Embedder string `json:"embedder"`
+	// EmbeddingURL is the base URL of the embeddings API, e.g.
+	// http://localhost:11434/v1. The API key, if one is needed, is read from
+	// the DOCUMCP_EMBEDDING_API_KEY environment variable.
+	EmbeddingURL string `json:"embedding_url"`
+	// EmbeddingModel is the model the embeddings API is asked for.
+	EmbeddingModel string `json:"embedding_model"`
+	// HNSWM, HNSWEfConstruction and HNSWEfSearch tune the approximate
+	// nearest neighbour graph used by vector search in large collections:
+	// links per node, and candidates considered when building and when
+	// searching. Higher values raise recall at the cost of speed and memory.
+	HNSWM              int `json:"hnsw_m"`
+	HNSWEfConstruction int `json:"hnsw_ef_construction"`
+	HNSWEfSearch       int `json:"hnsw_ef_search"`
+	// AllowedOrigins lists the origins, such as https://app.example.com,
+	// whose browser pages may call the MCP HTTP endpoint. Pages on
+	// loopback hosts are always allowed.
+	AllowedOrigins []string `json:"allowed_origins"`
 	// ... add more as needed
 }
 
+// defaultConfig returns the configuration written on first run. Fields
+// missing from an existing config.json keep these values.
+func defaultConfig() *Config {
+	return &Config{
+		AppName:            "documcp",
+		Version:            "0.1.0",
+		BM25K1:             1.2,
+		BM25B:              0.75,
+		Analyzer:           "english",
+		Embedder:           "hash",
+		EmbeddingURL:       "http://localhost:11434/v1",
+		EmbeddingModel:     "nomic-embed-text",
+		HNSWM:              16,
+		HNSWEfConstruction: 200,
+		HNSWEfSearch:       256,
+		AllowedOrigins:     []string{},
+		FieldBoosts: map[string]float64{
+			"title":   3,
+			"heading": 2,
+			"body":    1,
+			"code":    1.5,
+		},
+	}
+}
+
 // Validate checks if the config is valid.
 func (c *Config) Validate() error {
 	if c.AppName == "" {
@@ -32,6 +93,44 @@ func (c *Config) Validate() error {
 	if c.Version == "" {
 		return errors.New("version must not be empty")
 	}
+	if c.BM25K1 < 0 {
+		return errors.New("bm25_k1 must not be negative")
+	}
+	if c.BM25B < 0 || c.BM25B > 1 {
+		return errors.New("bm25_b must be between 0 and 1")
+	}
+	for field, boost := range c.FieldBoosts {
+		if boost < 0 {
+			return fmt.Errorf("field_boosts[%q] must not be negative", field)
+		}
+	}
+	if c.Analyzer == "" {
+		return errors.New("analyzer must not be empty")
+	}
+	switch c.Embedder {
+	case "hash":
+	case "openai":
+		if c.EmbeddingURL == "" {
+			return errors.New("embedding_url must not be empty for the openai embedder")
+		}
+		if c.EmbeddingModel == "" {
+			return errors.New("embedding_model must not be empty for the openai embedder")
+		}
+	default:
+		return fmt.Errorf("embedder must be \"hash\" or \"openai\", not %q", c.Embedder)
+	}
+	if c.HNSWM < 2 {
+		return errors.New("hnsw_m must be at least 2")
+	}
+	if c.HNSWEfConstruction < 1 || c.HNSWEfSearch < 1 {
+		return errors.New("hnsw_ef_construction and hnsw_ef_search must be positive")
+	}
+	for _, o := range c.AllowedOrigins {
+		u, err := url.Parse(o)
+		if err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return fmt.Errorf("allowed_origins entry %q is not an origin like https://example.com", o)
+		}
+	}
 	// ... add more validation as needed
 	return nil
 }
@@ -44,6 +143,36 @@ func (c *Config) applyEnvOverrides() {
 	if v := os.Getenv(envPrefix + "VERSION"); v != "" {
 		c.Version = v
 	}
+	if v, err := strconv.ParseFloat(os.Getenv(envPrefix+"BM25_K1"), 64); err == nil {
+		c.BM25K1 = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv(envPrefix+"BM25_B"), 64); err == nil {
+		c.BM25B = v
+	}
+	if v := os.Getenv(envPrefix + "ANALYZER"); v != "" {
+		c.Analyzer = v
+	}
+	if v := os.Getenv(envPrefix + "EMBEDDER"); v != "" {
+		c.Embedder = v
+	}
+	if v := os.Getenv(envPrefix + "EMBEDDING_URL"); v != "" {
+		c.EmbeddingURL = v
+	}
+	if v := os.Getenv(envPrefix + "EMBEDDING_MODEL"); v != "" {
+		c.EmbeddingModel = v
+	}
+	if v, err := strconv.Atoi(os.Getenv(envPrefix + "HNSW_M")); err == nil {
+		c.HNSWM = v
+	}
+	if v, err := strconv.Atoi(os.Getenv(envPrefix + "HNSW_EF_CONSTRUCTION")); err == nil {
+		c.HNSWEfConstruction = v
+	}
+	if v, err := strconv.Atoi(os.Getenv(envPrefix + "HNSW_EF_SEARCH")); err == nil {
+		c.HNSWEfSearch = v
+	}
+	if v := os.Getenv(envPrefix + "ALLOWED_ORIGINS"); v != "" {
+		c.AllowedOrigins = strings.Split(v, ",")
+	}
 	// ... add more overrides as needed
 }
 
@@ -81,10 +210,7 @@ func LoadConfig(dir string) (*Config, error) {
 	cfgPath := filepath.Join(dir, ConfigFileName)
 	f, err := os.Open(cfgPath)
 	if errors.Is(err, os.ErrNotExist) {
-		cfg := &Config{
-			AppName: "documcp",
-			Version: "0.1.0",
-		}
+		cfg := defaultConfig()
 		cfg.applyEnvOverrides()
 		if err := cfg.Validate(); err != nil {
 			fmt.Fprintf(os.Stderr, "Config validation error: %v\n", err)
@@ -100,7 +226,7 @@ func LoadConfig(dir string) (*Config, error) {
 		return nil, err
 	}
 	defer f.Close()
-	var cfg Config
+	cfg := *defaultConfig()
 	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
 		fmt.Fprintf(os.Stderr, "Config decode error: %v\n", err)
 		return nil, err
@@ -1,6 +1,7 @@
 package crawler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,13 +10,18 @@ import (
 	"path/filepath"
 	"sync"
 
+	"github.com/deepersensor/documcp/internal"
 	"golang.org/x/net/html"
 )
 
-// CrawlResult holds the crawled URL and its extracted text (stub for now).
+// CrawlResult holds a crawled page and the content extracted from it.
 type CrawlResult struct {
-	URL  string
-	Text string
+	URL      string
+	Title    string `json:",omitempty"`
+	Text     string
+	Headings []string  `json:",omitempty"`
+	Code     []string  `json:",omitempty"`
+	Sections []Section `json:",omitempty"`
 }
 
 // queueItem holds a URL and its crawl depth.
@@ -32,8 +38,13 @@ type Crawler struct {
 	Host       string
 	mu         sync.Mutex
 	wg         sync.WaitGroup
+	ctx        context.Context
+	maxPages   int
 	ProcessDir string // Directory for this crawl process
 	ProcessID  string // Unique process ID
+	// OnResult, if set, is called for every page collected with the running
+	// page count. It is called from a single goroutine and must not block.
+	OnResult func(res CrawlResult, pages int)
 }
 
 // NewCrawler creates a new Crawler for the given seed URL and process directory.
@@ -47,6 +58,7 @@ func NewCrawler(seed, processDir string) (*Crawler, error) {
 		Queue:      make(chan queueItem, 100),
 		Results:    make(chan CrawlResult, 100),
 		Host:       u.Host,
+		ctx:        context.Background(),
 		ProcessDir: processDir,
 		ProcessID:  filepath.Base(processDir),
 	}
@@ -54,101 +66,110 @@ func NewCrawler(seed, processDir string) (*Crawler, error) {
 }
 
 // Start begins crawling and persists results to processDir/results.json.
-func (c *Crawler) Start(seed string, maxDepth, maxPages, concurrency int) ([]CrawlResult, error) {
+// Cancelling ctx stops fetching new pages; the pages collected so far are
+// still saved and returned along with ctx.Err().
+func (c *Crawler) Start(ctx context.Context, seed string, maxDepth, maxPages, concurrency int) ([]CrawlResult, error) {
+	c.ctx = ctx
+	c.maxPages = maxPages
 	// Start the crawl with the seed URL
+	c.mu.Lock()
+	c.Visited[seed] = struct{}{}
+	c.mu.Unlock()
 	c.wg.Add(1)
 	go c.enqueue(seed, 0)
 
 	// Start worker goroutines
 	for i := 0; i < concurrency; i++ {
-		go c.worker(maxDepth, maxPages)
+		go c.worker(maxDepth)
 	}
 
 	var results []CrawlResult
 	done := make(chan struct{})
 	go func() {
 		for res := range c.Results {
-			results = append(results, res)
 			if len(results) >= maxPages {
-				break
+				continue
+			}
+			results = append(results, res)
+			if c.OnResult != nil {
+				c.OnResult(res, len(results))
 			}
 		}
 		close(done)
 	}()
 
-	// Wait for all URLs to be processed
+	// Wait for every queued URL to be crawled, then stop the workers and
+	// the result collector.
 	c.wg.Wait()
 	close(c.Queue)
-	// Wait for results to be collected or for maxPages to be reached
-	<-done
-	// After results are collected, close Results channel to terminate any consumers
 	close(c.Results)
+	<-done
 
 	// Persist results to disk
 	if err := c.saveResults(results); err != nil {
 		return results, err
 	}
-	return results, nil
+	return results, ctx.Err()
 }
 
-func (c *Crawler) worker(maxDepth, maxPages int) {
+func (c *Crawler) worker(maxDepth int) {
 	for item := range c.Queue {
-		c.crawl(item.url, item.depth, maxDepth, maxPages)
+		c.crawl(item.url, item.depth, maxDepth)
+		c.wg.Done()
 	}
 }
 
+// enqueue hands a URL to the workers. The caller must have marked it visited
+// and called wg.Add(1); the matching Done happens once it has been crawled.
 func (c *Crawler) enqueue(u string, depth int) {
-	defer c.wg.Done()
-	c.mu.Lock()
-	// If already visited or over maxPages, skip
-	if _, ok := c.Visited[u]; ok {
-		c.mu.Unlock()
-		return
-	}
-	c.Visited[u] = struct{}{}
-	c.mu.Unlock()
-	// Add to queue for processing
 	c.Queue <- queueItem{url: u, depth: depth}
 }
 
-func (c *Crawler) crawl(u string, depth, maxDepth, maxPages int) {
-	if depth > maxDepth {
+func (c *Crawler) crawl(u string, depth, maxDepth int) {
+	if depth > maxDepth || c.ctx.Err() != nil {
 		return
 	}
-	c.mu.Lock()
-	if len(c.Visited) > maxPages {
-		c.mu.Unlock()
+
+	fmt.Fprintf(os.Stderr, "[CRAWL] Depth %d: %s\n", depth, u)
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, u, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] Bad URL %s: %v\n", u, err)
 		return
 	}
-	c.mu.Unlock()
-
-	fmt.Printf("[CRAWL] Depth %d: %s\n", depth, u)
-	resp, err := http.Get(u)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		fmt.Printf("[ERROR] Failed to GET %s: %v\n", u, err)
+		fmt.Fprintf(os.Stderr, "[ERROR] Failed to GET %s: %v\n", u, err)
 		return
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("[ERROR] Non-OK status for %s: %d\n", u, resp.StatusCode)
+		fmt.Fprintf(os.Stderr, "[ERROR] Non-OK status for %s: %d\n", u, resp.StatusCode)
 		return
 	}
 	doc, err := html.Parse(resp.Body)
 	if err != nil {
-		fmt.Printf("[ERROR] Failed to parse HTML for %s: %v\n", u, err)
+		fmt.Fprintf(os.Stderr, "[ERROR] Failed to parse HTML for %s: %v\n", u, err)
 		return
 	}
-	text := extractText(doc)
-	c.Results <- CrawlResult{URL: u, Text: text}
+	res := CrawlResult{URL: u, Title: internal.ExtractTitle(doc)}
+	res.Text, res.Headings, res.Sections = extractText(doc)
+	for _, s := range res.Sections {
+		res.Code = append(res.Code, s.Code...)
+	}
+	c.Results <- res
 
-	links := extractLinks(doc, c.Host)
-	fmt.Printf("[LINKS] Found %d links on %s\n", len(links), u)
+	if depth >= maxDepth {
+		return
+	}
+	// Resolve links against the final URL, after any redirects.
+	links := extractLinks(doc, resp.Request.URL, c.Host)
+	fmt.Fprintf(os.Stderr, "[LINKS] Found %d links on %s\n", len(links), u)
 	for _, link := range links {
 		c.mu.Lock()
-		if _, ok := c.Visited[link]; !ok && len(c.Visited) < maxPages {
+		if _, ok := c.Visited[link]; !ok && len(c.Visited) < c.maxPages {
 			c.Visited[link] = struct{}{}
 			c.mu.Unlock()
-			fmt.Printf("[ENQUEUE] %s (depth %d)\n", link, depth+1)
+			fmt.Fprintf(os.Stderr, "[ENQUEUE] %s (depth %d)\n", link, depth+1)
 			c.wg.Add(1)
 			go c.enqueue(link, depth+1)
 		} else {
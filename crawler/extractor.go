@@ -3,50 +3,49 @@ package crawler
 import (
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"golang.org/x/net/html"
 )
 
-// extractLinks finds all internal links in the HTML document.
-func extractLinks(n *html.Node, baseHost string) []string {
+// extractLinks finds all links in the HTML document to pages on host.
+// Relative links are resolved against base, the URL of the document.
+func extractLinks(n *html.Node, base *url.URL, host string) []string {
 	var links []string
+	host = strings.TrimPrefix(host, "www.")
 	var f func(*html.Node)
 	f = func(n *html.Node) {
 		if n.Type == html.ElementNode && n.Data == "a" {
 			for _, attr := range n.Attr {
-				if attr.Key == "href" {
-					link := attr.Val
-					// Ignore empty, fragment, or mailto links
-					if link == "" || strings.HasPrefix(link, "#") || strings.HasPrefix(link, "mailto:") {
-						continue
-					}
-					// Resolve relative links
-					if strings.HasPrefix(link, "/") {
-						link = "https://" + baseHost + link
-					}
-					u, err := url.Parse(link)
-					if err != nil {
-						continue
-					}
-					// Normalize host (strip www.)
-					host := strings.TrimPrefix(u.Host, "www.")
-					base := strings.TrimPrefix(baseHost, "www.")
-					if host == "" {
-						u.Host = base
-						u.Scheme = "https"
-						link = u.String()
-						host = base
-					}
-					// Only follow links within the same host
-					if host == base && (u.Scheme == "http" || u.Scheme == "https") {
-						// Remove fragment
-						u.Fragment = ""
-						// Normalize path (remove duplicate slashes)
-						u.Path = path.Clean(u.Path)
-						links = append(links, u.String())
+				if attr.Key != "href" {
+					continue
+				}
+				link := strings.TrimSpace(attr.Val)
+				// Ignore empty, fragment, or mailto links
+				if link == "" || strings.HasPrefix(link, "#") || strings.HasPrefix(link, "mailto:") {
+					continue
+				}
+				ref, err := url.Parse(link)
+				if err != nil {
+					continue
+				}
+				u := base.ResolveReference(ref)
+				// Only follow links within the same host, ignoring www.
+				if strings.TrimPrefix(u.Host, "www.") != host || (u.Scheme != "http" && u.Scheme != "https") {
+					continue
+				}
+				u.Fragment = ""
+				// Normalize path (remove duplicate slashes)
+				if u.Path != "" {
+					trailing := strings.HasSuffix(u.Path, "/")
+					u.Path = path.Clean(u.Path)
+					if trailing && u.Path != "/" {
+						u.Path += "/"
 					}
 				}
+				links = append(links, u.String())
 			}
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
@@ -57,14 +56,223 @@ func extractLinks(n *html.Node, baseHost string) []string {
 	return links
 }
 
-// extractText is a stub for extracting visible text from HTML.
-func extractText(n *html.Node) string {
+// Section is the part of a page under one heading, up to the next heading
+// of any level.
+type Section struct {
+	Heading string   `json:",omitempty"` // empty for text before the first heading
+	Level   int      `json:",omitempty"` // 1-6 for h1-h6
+	Path    []string `json:",omitempty"` // headings of the enclosing sections, then this one
+	Anchor  string   `json:",omitempty"` // fragment identifier of the heading
+	Text    string
+	Code    []string `json:",omitempty"`
+}
+
+// skippedElements hold no visible text.
+var skippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true, "svg": true,
+}
+
+// blockElements start and end a line of text.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true,
+	"dd": true, "details": true, "div": true, "dl": true, "dt": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "header": true, "hr": true, "li": true,
+	"main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true,
+	"summary": true, "table": true, "td": true, "th": true, "tr": true, "ul": true,
+}
+
+// headingLevel returns 1-6 for an h1-h6 element and 0 otherwise.
+func headingLevel(n *html.Node) int {
+	if n.Type != html.ElementNode || len(n.Data) != 2 || n.Data[0] != 'h' || n.Data[1] < '1' || n.Data[1] > '6' {
+		return 0
+	}
+	return int(n.Data[1] - '0')
+}
+
+// extractText returns the visible text of the document, its headings and
+// its sections. Block elements and headings are separated by line breaks,
+// other whitespace is collapsed except inside <pre>.
+func extractText(n *html.Node) (text string, headings []string, sections []Section) {
+	e := &textExtractor{anchors: make(map[string]int)}
+	e.walk(n, false)
+	e.flush()
+	return e.page.String(), e.headings, e.sections
+}
+
+// textExtractor accumulates the text of a page and of its current section.
+type textExtractor struct {
+	page, section textBuilder
+	current       Section
+	stack         []Section // enclosing headings
+	headings      []string
+	sections      []Section
+	anchors       map[string]int // anchors used so far
+}
+
+func (e *textExtractor) walk(n *html.Node, pre bool) {
+	switch n.Type {
+	case html.TextNode:
+		e.page.write(n.Data, pre)
+		e.section.write(n.Data, pre)
+		return
+	case html.ElementNode:
+		if skippedElements[n.Data] {
+			return
+		}
+		if level := headingLevel(n); level > 0 {
+			e.heading(n, level)
+			return
+		}
+		switch n.Data {
+		case "pre":
+			e.current.Code = append(e.current.Code, nodeText(n))
+			pre = true
+		case "code":
+			if !pre {
+				e.current.Code = append(e.current.Code, nodeText(n))
+			}
+		}
+	}
+	block := n.Type == html.ElementNode && blockElements[n.Data]
+	if block {
+		e.page.lineBreak()
+		e.section.lineBreak()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		e.walk(c, pre)
+	}
+	if block {
+		e.page.lineBreak()
+		e.section.lineBreak()
+	}
+}
+
+// heading ends the current section and starts the one under n.
+func (e *textExtractor) heading(n *html.Node, level int) {
+	e.flush()
+	text := strings.Join(strings.Fields(nodeText(n)), " ")
+	e.page.lineBreak()
+	e.page.write(text, false)
+	e.page.lineBreak()
+	e.headings = append(e.headings, text)
+	for len(e.stack) > 0 && e.stack[len(e.stack)-1].Level >= level {
+		e.stack = e.stack[:len(e.stack)-1]
+	}
+	var path []string
+	for _, s := range e.stack {
+		path = append(path, s.Heading)
+	}
+	e.current = Section{
+		Heading: text,
+		Level:   level,
+		Path:    append(path, text),
+		Anchor:  e.anchor(n, text),
+	}
+	e.stack = append(e.stack, e.current)
+}
+
+// anchor returns the fragment identifier of a heading: its id, or that of
+// a named anchor inside it, or else a slug of its text like the ones
+// generated by common documentation tools. Repeated slugs get a numeric
+// suffix.
+func (e *textExtractor) anchor(n *html.Node, text string) string {
+	if id := attr(n, "id"); id != "" {
+		return id
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "a" {
+			if id := attr(c, "id"); id != "" {
+				return id
+			}
+			if name := attr(c, "name"); name != "" {
+				return name
+			}
+		}
+	}
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	slug := b.String()
+	if slug == "" {
+		return ""
+	}
+	n2 := e.anchors[slug]
+	e.anchors[slug]++
+	if n2 > 0 {
+		slug += "-" + strconv.Itoa(n2)
+	}
+	return slug
+}
+
+// flush records the current section if it has any text.
+func (e *textExtractor) flush() {
+	e.current.Text = e.section.String()
+	if e.current.Text != "" || len(e.current.Code) > 0 {
+		e.sections = append(e.sections, e.current)
+	}
+	e.section = textBuilder{}
+	e.current = Section{}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+// nodeText returns the concatenated text of a node and its children.
+func nodeText(n *html.Node) string {
 	if n.Type == html.TextNode {
-		return strings.TrimSpace(n.Data)
+		return n.Data
 	}
 	var sb strings.Builder
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		sb.WriteString(extractText(c))
+		sb.WriteString(nodeText(c))
 	}
 	return sb.String()
 }
+
+// textBuilder joins text nodes, collapsing whitespace into single spaces
+// and line breaks into single newlines.
+type textBuilder struct {
+	b              strings.Builder
+	space, newline bool
+}
+
+// write appends text. Inside <pre> whitespace is kept as it is.
+func (t *textBuilder) write(s string, pre bool) {
+	for _, r := range s {
+		if !pre && unicode.IsSpace(r) {
+			t.space = true
+			continue
+		}
+		if t.b.Len() > 0 {
+			switch {
+			case t.newline:
+				t.b.WriteByte('\n')
+			case t.space:
+				t.b.WriteByte(' ')
+			}
+		}
+		t.space, t.newline = false, false
+		t.b.WriteRune(r)
+	}
+}
+
+// lineBreak ends the current line.
+func (t *textBuilder) lineBreak() {
+	t.newline = true
+}
+
+func (t *textBuilder) String() string {
+	return t.b.String()
+}
@@ -0,0 +1,102 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// describeSections renders sections one per line as
+// "level anchor path: text [code]".
+func describeSections(sections []Section) string {
+	lines := make([]string, len(sections))
+	for i, s := range sections {
+		lines[i] = fmt.Sprintf("%d #%s %s: %s", s.Level, s.Anchor, strings.Join(s.Path, " > "), strings.ReplaceAll(s.Text, "\n", " / "))
+		if len(s.Code) > 0 {
+			lines[i] += " " + fmt.Sprint(s.Code)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestExtractSections(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "nested headings",
+			html: `<p>Intro</p><h1>Guide</h1><p>Welcome.</p><h2>Install</h2><p>Run it.</p>
+				<h3>Linux</h3><p>Use apt.</p><h2>Usage</h2><p>Call it.</p>`,
+			want: "0 # : Intro\n" +
+				"1 #guide Guide: Welcome.\n" +
+				"2 #install Guide > Install: Run it.\n" +
+				"3 #linux Guide > Install > Linux: Use apt.\n" +
+				"2 #usage Guide > Usage: Call it.",
+		},
+		{
+			name: "skipped levels",
+			html: `<h3>Deep</h3><p>a</p><h1>Top</h1><p>b</p><h4>Under</h4><p>c</p>`,
+			want: "3 #deep Deep: a\n" +
+				"1 #top Top: b\n" +
+				"4 #under Top > Under: c",
+		},
+		{
+			name: "anchors",
+			html: `<h2 id="custom">Custom id</h2><p>a</p>
+				<h2><a name="legacy"></a>Named anchor</h2><p>b</p>
+				<h2>Set up &amp; run!</h2><p>c</p>
+				<h2>Set up &amp; run!</h2><p>d</p>
+				<h2>Überblick</h2><p>e</p>`,
+			want: "2 #custom Custom id: a\n" +
+				"2 #legacy Named anchor: b\n" +
+				"2 #set-up--run Set up & run!: c\n" +
+				"2 #set-up--run-1 Set up & run!: d\n" +
+				"2 #überblick Überblick: e",
+		},
+		{
+			name: "empty sections are dropped",
+			html: `<h1>Title</h1><h2>Empty</h2><h2>Full</h2><p>text</p>`,
+			want: "2 #full Title > Full: text",
+		},
+		{
+			name: "code",
+			html: `<h2>Example</h2><p>Call <code>run()</code>:</p><pre><code>x := run()
+y := x</code></pre>`,
+			want: "2 #example Example: Call run(): / x := run() / y := x [run() x := run()\ny := x]",
+		},
+		{
+			name: "hidden text",
+			html: `<head><title>T</title></head><h2>Visible</h2><script>var x;</script><p>shown</p><template>not shown</template>`,
+			want: "2 #visible Visible: shown",
+		},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, sections := extractText(doc)
+		if got := describeSections(sections); got != tt.want {
+			t.Errorf("%s: sections\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractTextAndHeadings(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<h1>Guide</h1><p>First   line.</p><div>Second<br>third</div><pre>  keep
+  spacing</pre><h2>Next</h2>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, headings, _ := extractText(doc)
+	if want := "Guide\nFirst line.\nSecond\nthird\n  keep\n  spacing\nNext"; text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+	if got := strings.Join(headings, "|"); got != "Guide|Next" {
+		t.Errorf("headings = %q, want %q", got, "Guide|Next")
+	}
+}
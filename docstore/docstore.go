@@ -1,6 +1,9 @@
 package docstore
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
 // Document represents a structured crawled document.
 type Document struct {
@@ -13,6 +16,17 @@ type Document struct {
 	Metadata     map[string]string // Arbitrary metadata (e.g., last-modified)
 	Version      int               // Version number for changed documents
 	LastUpdated  time.Time         // Last update timestamp
+
+	// A page is split into sections at its headings. Each section is also
+	// stored as a document, whose URL points at the heading's anchor.
+	ParentID string   `json:",omitempty"` // page a section belongs to; empty for pages
+	Path     []string `json:",omitempty"` // heading path of a section, outermost first
+	Sections []string `json:",omitempty"` // IDs of a page's sections, in page order
+}
+
+// IsSection reports whether d is a section of a page rather than a page.
+func (d *Document) IsSection() bool {
+	return d.ParentID != ""
 }
 
 // NewDocument creates a new Document with the given fields.
@@ -29,3 +43,71 @@ func NewDocument(id, url, title, text string, headings, codeSnippets []string, m
 		LastUpdated:  time.Now(),
 	}
 }
+
+// Store is a concurrency-safe collection of documents keyed by ID.
+type Store struct {
+	mu   sync.RWMutex
+	docs map[string]*Document
+}
+
+// NewStore creates an empty Store.
+func NewStore() *Store {
+	return &Store{docs: make(map[string]*Document)}
+}
+
+// Get returns the document with the given ID.
+func (s *Store) Get(id string) (*Document, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.docs[id]
+	return d, ok
+}
+
+// Put adds or replaces a document.
+func (s *Store) Put(d *Document) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs[d.ID] = d
+}
+
+// Delete removes the document with the given ID, reporting whether it was
+// there.
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.docs[id]
+	delete(s.docs, id)
+	return ok
+}
+
+// All returns every document in the store, in no particular order.
+func (s *Store) All() []*Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	docs := make([]*Document, 0, len(s.docs))
+	for _, d := range s.docs {
+		docs = append(docs, d)
+	}
+	return docs
+}
+
+// Pages returns every page in the store, leaving out their sections, in no
+// particular order.
+func (s *Store) Pages() []*Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	docs := make([]*Document, 0, len(s.docs))
+	for _, d := range s.docs {
+		if !d.IsSection() {
+			docs = append(docs, d)
+		}
+	}
+	return docs
+}
+
+// Len returns the number of documents in the store.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.docs)
+}
@@ -0,0 +1,54 @@
+package docstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/deepersensor/documcp/internal"
+)
+
+// FormatVersion is the version of the on-disk docstore format written by Save.
+const FormatVersion = 1
+
+// storeFile is the on-disk representation of a Store.
+type storeFile struct {
+	FormatVersion int         `json:"format_version"`
+	Documents     []*Document `json:"documents"`
+}
+
+// Save atomically writes the store to path.
+func (s *Store) Save(path string) error {
+	docs := s.All()
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	f := storeFile{FormatVersion: FormatVersion, Documents: docs}
+	return internal.WriteFileAtomic(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(&f)
+	})
+}
+
+// LoadStore reads a store written by Save. A missing file yields an empty store.
+func LoadStore(path string) (*Store, error) {
+	s := NewStore()
+	data, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	var f storeFile
+	if err := json.NewDecoder(data).Decode(&f); err != nil {
+		return nil, fmt.Errorf("decode docstore %s: %w", path, err)
+	}
+	if f.FormatVersion < 1 || f.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("docstore %s has unsupported format version %d (want %d)", path, f.FormatVersion, FormatVersion)
+	}
+	for _, d := range f.Documents {
+		s.docs[d.ID] = d
+	}
+	return s, nil
+}
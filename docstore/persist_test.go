@@ -0,0 +1,116 @@
+package docstore
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	s := NewStore()
+	a := NewDocument("a", "http://example.com/a", "A", "Alpha text.", []string{"Alpha"}, []string{"x := 1"}, map[string]string{"etag": "1"}, 2)
+	b := NewDocument("b", "http://example.com/b", "", "Beta text.", nil, nil, nil, 1)
+	s.Put(a)
+	s.Put(b)
+	path := filepath.Join(t.TempDir(), "docstore.json")
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != 2 {
+		t.Fatalf("loaded %d documents, want 2", loaded.Len())
+	}
+	for _, want := range []*Document{a, b} {
+		got, ok := loaded.Get(want.ID)
+		if !ok {
+			t.Errorf("document %s missing after load", want.ID)
+			continue
+		}
+		if !got.LastUpdated.Equal(want.LastUpdated) {
+			t.Errorf("document %s: LastUpdated %v, want %v", want.ID, got.LastUpdated, want.LastUpdated)
+		}
+		got.LastUpdated = want.LastUpdated
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("document %s = %+v, want %+v", want.ID, got, want)
+		}
+	}
+}
+
+func TestLoadStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string // file contents, or "" for no file
+		docs    int
+		wantErr bool
+	}{
+		{name: "missing file", docs: 0},
+		{name: "current version", data: `{"format_version":1,"documents":[{"ID":"a","URL":"http://example.com/a"}]}`, docs: 1},
+		{name: "newer version", data: `{"format_version":2,"documents":[]}`, wantErr: true},
+		{name: "no version", data: `{"documents":[]}`, wantErr: true},
+		{name: "corrupt", data: `{"format_version":1,"documents":[`, wantErr: true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "docstore.json")
+		if tt.data != "" {
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s, err := LoadStore(path)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: LoadStore succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if s.Len() != tt.docs {
+			t.Errorf("%s: loaded %d documents, want %d", tt.name, s.Len(), tt.docs)
+		}
+	}
+}
+
+func TestFailedSaveKeepsPreviousFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "docstore.json")
+	s := NewStore()
+	s.Put(NewDocument("a", "http://example.com/a", "A", "Alpha text.", nil, nil, nil, 1))
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Times past year 9999 cannot be encoded, so this save fails midway.
+	bad := NewDocument("b", "http://example.com/b", "B", "Beta text.", nil, nil, nil, 1)
+	bad.LastUpdated = time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Put(bad)
+	if err := s.Save(path); err == nil {
+		t.Fatal("Save succeeded, want an encoding error")
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("failed save changed the file:\n%s\nwant\n%s", after, before)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d entries after a failed save, want only the store file", len(entries))
+	}
+}
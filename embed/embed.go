@@ -0,0 +1,37 @@
+// Package embed turns text into vectors for semantic search.
+package embed
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/deepersensor/documcp/config"
+	"github.com/deepersensor/documcp/index"
+)
+
+// Embedder computes a vector for each of a batch of texts. Texts with
+// similar meanings get vectors pointing in similar directions.
+type Embedder interface {
+	// Embed returns one vector per text, in order, all of the same length.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Name identifies the model. Vectors from embedders with different
+	// names are not comparable.
+	Name() string
+}
+
+// New returns the embedder selected by the configuration.
+func New(cfg *config.Config) (Embedder, error) {
+	switch cfg.Embedder {
+	case "hash":
+		analyzer, err := index.NewAnalyzer(cfg.Analyzer)
+		if err != nil {
+			return nil, err
+		}
+		return NewHashEmbedder(DefaultHashDim, analyzer), nil
+	case "openai":
+		return NewOpenAIEmbedder(cfg.EmbeddingURL, cfg.EmbeddingModel, os.Getenv("DOCUMCP_EMBEDDING_API_KEY")), nil
+	default:
+		return nil, fmt.Errorf("unknown embedder %q", cfg.Embedder)
+	}
+}
@@ -0,0 +1,98 @@
+package embed
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"github.com/deepersensor/documcp/index"
+)
+
+// DefaultHashDim is the vector length of the built-in embedder.
+const DefaultHashDim = 512
+
+// Feature weights of the hash embedder.
+const (
+	termWeight  = 1.0
+	ngramWeight = 1.0 // shared by all character n-grams of a term
+)
+
+// ngramSizes are the lengths of the character n-grams taken from each term.
+var ngramSizes = []int{3, 4}
+
+// HashEmbedder is an offline embedder that projects text onto a fixed
+// number of dimensions by feature hashing. Text is analyzed into terms as
+// for the lexical index, and each term contributes itself and its character
+// n-grams, each hashed to a dimension and a sign. The n-grams let related
+// word forms, compounds and typos share features. Texts are close when they
+// share terms; there is no notion of meaning beyond that.
+type HashEmbedder struct {
+	dim      int
+	analyzer *index.Analyzer
+}
+
+// NewHashEmbedder returns a hash embedder producing vectors of length dim
+// from the terms analyzer produces.
+func NewHashEmbedder(dim int, analyzer *index.Analyzer) *HashEmbedder {
+	return &HashEmbedder{dim: dim, analyzer: analyzer}
+}
+
+// Name identifies the feature set, analyzer and vector length.
+func (e *HashEmbedder) Name() string {
+	return fmt.Sprintf("hash-v2-%s-%d", e.analyzer, e.dim)
+}
+
+// Embed never fails unless ctx is done.
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vecs := make([][]float32, len(texts))
+	for i, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		vecs[i] = e.embed(text)
+	}
+	return vecs, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	vec := make([]float64, e.dim)
+	for _, term := range e.analyzer.Terms(text) {
+		e.add(vec, "w:"+term, termWeight)
+		padded := []rune("^" + term + "$")
+		var ngrams []string
+		for _, n := range ngramSizes {
+			for i := 0; i+n <= len(padded); i++ {
+				ngrams = append(ngrams, string(padded[i:i+n]))
+			}
+		}
+		for _, g := range ngrams {
+			e.add(vec, "g:"+g, ngramWeight/float64(len(ngrams)))
+		}
+	}
+	var norm float64
+	for _, x := range vec {
+		norm += x * x
+	}
+	out := make([]float32, e.dim)
+	if norm == 0 {
+		return out
+	}
+	norm = math.Sqrt(norm)
+	for i, x := range vec {
+		out[i] = float32(x / norm)
+	}
+	return out
+}
+
+// add hashes a feature to a dimension and a sign, so that collisions cancel
+// out rather than pile up.
+func (e *HashEmbedder) add(vec []float64, feature string, weight float64) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vec[sum%uint64(e.dim)] += weight
+}
@@ -0,0 +1,118 @@
+package embed
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/deepersensor/documcp/index"
+)
+
+// cosine returns the cosine similarity of a and b.
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// newTestEmbedder returns a hash embedder using the default analyzer.
+func newTestEmbedder(t *testing.T) *HashEmbedder {
+	t.Helper()
+	analyzer, err := index.NewAnalyzer(index.DefaultAnalyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHashEmbedder(DefaultHashDim, analyzer)
+}
+
+func TestHashEmbedderDeterministic(t *testing.T) {
+	texts := []string{"Cancel a running task.", "Install the database driver.", ""}
+	a, err := newTestEmbedder(t).Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newTestEmbedder(t).Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range texts {
+		if len(a[i]) != DefaultHashDim {
+			t.Errorf("vector %d has %d dimensions, want %d", i, len(a[i]), DefaultHashDim)
+		}
+		if !slices.Equal(a[i], b[i]) {
+			t.Errorf("embedding %q twice gave different vectors", texts[i])
+		}
+	}
+	if norm := cosine(a[0], a[0]); math.Abs(norm-1) > 1e-6 {
+		t.Errorf("cosine of a vector with itself = %v, want 1", norm)
+	}
+}
+
+func TestHashEmbedderRelatedTexts(t *testing.T) {
+	tests := []struct {
+		text, related, unrelated string
+	}{
+		{"cancel a running task", "cancelling tasks that are running", "install the database driver"},
+		{"configure the connection pool", "connection pool configuration", "cancel a running task"},
+		{"retry failed requests", "requests are retried when they fail", "render the page title"},
+		// Character n-grams relate typos and compounds.
+		{"connection pool", "conection pooling", "install the driver"},
+		{"database", "databases and data stores", "request timeouts"},
+	}
+	e := newTestEmbedder(t)
+	for _, tt := range tests {
+		vecs, err := e.Embed(context.Background(), []string{tt.text, tt.related, tt.unrelated})
+		if err != nil {
+			t.Fatal(err)
+		}
+		related, unrelated := cosine(vecs[0], vecs[1]), cosine(vecs[0], vecs[2])
+		if related <= unrelated {
+			t.Errorf("%q: cosine %.3f with %q, want above %.3f with %q", tt.text, related, tt.related, unrelated, tt.unrelated)
+		}
+	}
+}
+
+// TestHashEmbedderAnalyzer checks that texts the lexical index cannot tell
+// apart get the same vector.
+func TestHashEmbedderAnalyzer(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"Café menu", "cafe MENU"},
+		{"the connection pool", "connection pool"},
+		{"cancelled tasks", "cancel task"},
+	}
+	e := newTestEmbedder(t)
+	for _, tt := range tests {
+		vecs, err := e.Embed(context.Background(), []string{tt.a, tt.b})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(vecs[0], vecs[1]) {
+			t.Errorf("%q and %q got different vectors", tt.a, tt.b)
+		}
+	}
+	standard, err := index.NewAnalyzer("standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := e.Name(), NewHashEmbedder(DefaultHashDim, standard).Name(); a == b {
+		t.Errorf("embedders with different analyzers are both named %q", a)
+	}
+}
+
+func TestHashEmbedderCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := newTestEmbedder(t).Embed(ctx, []string{"text"}); err == nil {
+		t.Error("Embed succeeded with a canceled context")
+	}
+}
@@ -0,0 +1,88 @@
+package embed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIEmbedder calls an OpenAI-compatible embeddings API, such as the ones
+// served locally by Ollama, llama.cpp or vLLM.
+type OpenAIEmbedder struct {
+	baseURL string
+	model   string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewOpenAIEmbedder returns an embedder posting to baseURL + "/embeddings".
+// apiKey is sent as a bearer token unless it is empty.
+func NewOpenAIEmbedder(baseURL, model, apiKey string) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// Name identifies the model.
+func (e *OpenAIEmbedder) Name() string {
+	return "openai:" + e.model
+}
+
+// Embed sends the texts in one request.
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": e.model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("embeddings request: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var out struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode embeddings response: %w", err)
+	}
+	if len(out.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings response has %d vectors for %d texts", len(out.Data), len(texts))
+	}
+	vecs := make([][]float32, len(texts))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(texts) || vecs[d.Index] != nil {
+			return nil, fmt.Errorf("embeddings response has invalid index %d", d.Index)
+		}
+		if len(d.Embedding) == 0 {
+			return nil, fmt.Errorf("embeddings response has an empty vector at index %d", d.Index)
+		}
+		if len(d.Embedding) != len(out.Data[0].Embedding) {
+			return nil, fmt.Errorf("embeddings response has vectors of %d and %d dimensions", len(out.Data[0].Embedding), len(d.Embedding))
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	return vecs, nil
+}
@@ -0,0 +1,107 @@
+package embed
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIEmbedder(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    [][]float32
+		wantErr string
+	}{
+		{
+			name: "in order",
+			body: `{"data":[{"index":0,"embedding":[1,0]},{"index":1,"embedding":[0,1]}]}`,
+			want: [][]float32{{1, 0}, {0, 1}},
+		},
+		{
+			name: "out of order",
+			body: `{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`,
+			want: [][]float32{{1, 0}, {0, 1}},
+		},
+		{
+			name:    "too few vectors",
+			body:    `{"data":[{"index":0,"embedding":[1,0]}]}`,
+			wantErr: "1 vectors for 2 texts",
+		},
+		{
+			name:    "repeated index",
+			body:    `{"data":[{"index":0,"embedding":[1,0]},{"index":0,"embedding":[0,1]}]}`,
+			wantErr: "invalid index 0",
+		},
+		{
+			name:    "index out of range",
+			body:    `{"data":[{"index":0,"embedding":[1,0]},{"index":2,"embedding":[0,1]}]}`,
+			wantErr: "invalid index 2",
+		},
+		{
+			name:    "mismatched dimensions",
+			body:    `{"data":[{"index":0,"embedding":[1,0]},{"index":1,"embedding":[0,1,0]}]}`,
+			wantErr: "vectors of 2 and 3 dimensions",
+		},
+		{
+			name:    "empty vector",
+			body:    `{"data":[{"index":0,"embedding":[]},{"index":1,"embedding":[]}]}`,
+			wantErr: "empty vector at index 0",
+		},
+		{
+			name:    "HTTP error",
+			status:  http.StatusUnauthorized,
+			body:    `{"error":"invalid api key"}`,
+			wantErr: `401 Unauthorized: {"error":"invalid api key"}`,
+		},
+		{
+			name:    "malformed response",
+			body:    `{"data":`,
+			wantErr: "decode embeddings response",
+		},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Model string   `json:"model"`
+				Input []string `json:"input"`
+			}
+			if r.URL.Path != "/v1/embeddings" || r.Header.Get("Authorization") != "Bearer key" {
+				t.Errorf("%s: request to %s with authorization %q", tt.name, r.URL.Path, r.Header.Get("Authorization"))
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model != "m" || len(req.Input) != 2 {
+				t.Errorf("%s: bad request body %+v: %v", tt.name, req, err)
+			}
+			if tt.status != 0 {
+				w.WriteHeader(tt.status)
+			}
+			w.Write([]byte(tt.body))
+		}))
+		vecs, err := NewOpenAIEmbedder(srv.URL+"/v1/", "m", "key").Embed(context.Background(), []string{"a", "b"})
+		srv.Close()
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(vecs) != len(tt.want) {
+			t.Errorf("%s: %d vectors, want %d", tt.name, len(vecs), len(tt.want))
+			continue
+		}
+		for i := range vecs {
+			if !slices.Equal(vecs[i], tt.want[i]) {
+				t.Errorf("%s: vector %d = %v, want %v", tt.name, i, vecs[i], tt.want[i])
+			}
+		}
+	}
+}
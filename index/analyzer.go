@@ -0,0 +1,219 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Filter rewrites one token of an analyzer chain. Returning "" drops the
+// token; its position is kept, so phrases spanning it still line up.
+type Filter func(term string) string
+
+var (
+	filtersMu sync.RWMutex
+	filters   = map[string]Filter{
+		"lowercase": strings.ToLower,
+		"fold":      foldDiacritics,
+		"stop":      dropStopWord,
+		"stem":      stem,
+	}
+)
+
+// RegisterFilter makes a filter available to analyzer specs under name. It
+// replaces any filter already registered with that name.
+func RegisterFilter(name string, f Filter) {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+	filters[name] = f
+}
+
+// analyzerPresets are named filter chains accepted by NewAnalyzer.
+var analyzerPresets = map[string][]string{
+	"standard": {"lowercase", "fold"},
+	"english":  {"lowercase", "fold", "stop", "stem"},
+}
+
+// DefaultAnalyzer is the analyzer spec used when none is configured.
+const DefaultAnalyzer = "english"
+
+// Analyzer turns text into index terms. The tokenizer splits text into
+// words, identifier parts and CJK bigrams, and each filter of the chain then
+// rewrites or drops every token in turn. Documents and queries must be
+// analyzed by the same chain, so an index records the chain it was built
+// with.
+type Analyzer struct {
+	names   []string
+	filters []Filter
+}
+
+// NewAnalyzer returns the analyzer described by spec: a preset name
+// ("standard" or "english") or a comma-separated list of filters, e.g.
+// "lowercase,fold,stop". The built-in filters are lowercase, fold (strip
+// diacritics), stop (drop English stop words) and stem (Porter stemmer).
+func NewAnalyzer(spec string) (*Analyzer, error) {
+	spec = strings.TrimSpace(spec)
+	if names, ok := analyzerPresets[spec]; ok {
+		return newAnalyzer(names)
+	}
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return newAnalyzer(names)
+}
+
+func newAnalyzer(names []string) (*Analyzer, error) {
+	filtersMu.RLock()
+	defer filtersMu.RUnlock()
+	a := &Analyzer{names: append([]string(nil), names...)}
+	for _, name := range names {
+		f, ok := filters[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown analyzer filter %q (available: %s)", name, strings.Join(filterNames(), ", "))
+		}
+		a.filters = append(a.filters, f)
+	}
+	return a, nil
+}
+
+// filterNames returns the registered filter names, sorted. filtersMu must be
+// held.
+func filterNames() []string {
+	names := make([]string, 0, len(filters))
+	for name := range filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Filters returns the names of the analyzer's filters in order.
+func (a *Analyzer) Filters() []string {
+	return append([]string(nil), a.names...)
+}
+
+// String returns the analyzer's spec, using a preset name when one matches.
+func (a *Analyzer) String() string {
+	for name, chain := range analyzerPresets {
+		if equalStrings(chain, a.names) {
+			return name
+		}
+	}
+	return strings.Join(a.names, ",")
+}
+
+// Equal reports whether two analyzers apply the same filters.
+func (a *Analyzer) Equal(b *Analyzer) bool {
+	return equalStrings(a.names, b.names)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// analyze tokenizes text and runs every token through the filter chain.
+func (a *Analyzer) analyze(text string, mode analyzeMode) []token {
+	tokens := splitTokens(text, mode)
+	out := tokens[:0]
+	for _, t := range tokens {
+		t.surface = strings.ToLower(t.text)
+		for _, f := range a.filters {
+			if t.text = f(t.text); t.text == "" {
+				break
+			}
+		}
+		if t.text != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// tokenize returns the terms of document text; see splitTokens.
+func (a *Analyzer) tokenize(text string) []token {
+	return a.analyze(text, modeIndex)
+}
+
+// normalize lower-cases a word and folds its diacritics if the chain does,
+// leaving out the filters that drop or stem words. Prefixes are matched
+// against indexed words in this form, so "cafe*" finds "café".
+func (a *Analyzer) normalize(word string) string {
+	word = strings.ToLower(word)
+	for i, name := range a.names {
+		if name == "fold" {
+			word = a.filters[i](word)
+		}
+	}
+	return word
+}
+
+// Terms returns the terms text is indexed under, in order. Code
+// identifiers yield both the whole identifier and its parts.
+func (a *Analyzer) Terms(text string) []string {
+	tokens := a.tokenize(text)
+	terms := make([]string, len(tokens))
+	for i, t := range tokens {
+		terms[i] = t.text
+	}
+	return terms
+}
+
+// tokenizeQuery returns the terms of a query word. Identifiers are kept
+// whole: a query for max_retries matches that exact symbol, while a query
+// for "max retries" matches its parts.
+func (a *Analyzer) tokenizeQuery(text string) []token {
+	return a.analyze(text, modeQuery)
+}
+
+// tokenizePhrase returns the terms of a phrase with their positions.
+// Identifiers are replaced by their parts, which are always indexed next to
+// each other.
+func (a *Analyzer) tokenizePhrase(text string) []token {
+	return a.analyze(text, modePhrase)
+}
+
+// foldDiacritics replaces letters with diacritics and ligatures by their
+// base letters, so "café" matches "cafe".
+func foldDiacritics(term string) string {
+	if !strings.ContainsFunc(term, func(r rune) bool { return r > unicode.MaxASCII }) {
+		return term
+	}
+	var b strings.Builder
+	for _, r := range term {
+		if s, ok := foldTable[r]; ok {
+			b.WriteString(s)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// stopWords are common English words that carry little meaning for search.
+var stopWords = map[string]struct{}{
+	"a": {}, "an": {}, "and": {}, "are": {}, "as": {}, "at": {}, "be": {},
+	"but": {}, "by": {}, "for": {}, "if": {}, "in": {}, "into": {}, "is": {},
+	"it": {}, "no": {}, "not": {}, "of": {}, "on": {}, "or": {}, "such": {},
+	"that": {}, "the": {}, "their": {}, "then": {}, "there": {}, "these": {},
+	"they": {}, "this": {}, "to": {}, "was": {}, "will": {}, "with": {},
+}
+
+func dropStopWord(term string) string {
+	if _, ok := stopWords[strings.ToLower(term)]; ok {
+		return ""
+	}
+	return term
+}
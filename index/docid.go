@@ -0,0 +1,54 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// DocID returns the ID of the document at a URL: 16 hex digits of the
+// SHA-256 of the canonical URL. IDs stay the same across crawls, restarts
+// and machines, so they can be bookmarked and shared. A URL with a fragment
+// gets the ID of the section at that anchor, as SectionID does.
+func DocID(rawURL string) string {
+	return hashID(CanonicalURL(rawURL))
+}
+
+// SectionID returns the ID of the section of a page starting at anchor.
+// The section before a page's first heading has an empty anchor, and an ID
+// of its own, distinct from the page's.
+func SectionID(pageURL, anchor string) string {
+	page, _, _ := strings.Cut(CanonicalURL(pageURL), "#")
+	return hashID(page + "#" + anchor)
+}
+
+// CanonicalURL normalizes the parts of a URL that do not change what it
+// points to: the case of the scheme and host, a default port, an empty path
+// and the order of query parameters. Unparseable URLs are returned
+// unchanged.
+func CanonicalURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); u.Scheme == "http" && port == "80" || u.Scheme == "https" && port == "443" {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	if u.Host != "" && u.Path == "" && u.Opaque == "" {
+		u.Path = "/"
+	}
+	if u.RawQuery != "" {
+		if q, err := url.ParseQuery(u.RawQuery); err == nil {
+			u.RawQuery = q.Encode()
+		}
+	}
+	return u.String()
+}
+
+func hashID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,66 @@
+package index
+
+import "testing"
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"scheme case", "HTTP://example.com/docs", "http://example.com/docs", true},
+		{"host case", "http://Example.COM/docs", "http://example.com/docs", true},
+		{"path case", "http://example.com/Docs", "http://example.com/docs", false},
+		{"default http port", "http://example.com:80/docs", "http://example.com/docs", true},
+		{"default https port", "https://example.com:443/docs", "https://example.com/docs", true},
+		{"other port", "http://example.com:8080/docs", "http://example.com/docs", false},
+		{"https port on http", "http://example.com:443/docs", "http://example.com/docs", false},
+		{"empty path", "http://example.com", "http://example.com/", true},
+		{"trailing slash", "http://example.com/docs/", "http://example.com/docs", false},
+		{"query parameter order", "http://example.com/docs?v=2&lang=go", "http://example.com/docs?lang=go&v=2", true},
+		{"query values", "http://example.com/docs?v=2", "http://example.com/docs?v=3", false},
+		{"fragment", "http://example.com/docs#install", "http://example.com/docs", false},
+		{"scheme", "https://example.com/docs", "http://example.com/docs", false},
+	}
+	for _, tt := range tests {
+		if same := DocID(tt.a) == DocID(tt.b); same != tt.same {
+			t.Errorf("%s: DocID(%q) == DocID(%q) is %v, want %v (canonical %q and %q)",
+				tt.name, tt.a, tt.b, same, tt.same, CanonicalURL(tt.a), CanonicalURL(tt.b))
+		}
+	}
+}
+
+func TestDocIDFormat(t *testing.T) {
+	id := DocID("http://example.com/docs")
+	if len(id) != 16 {
+		t.Errorf("DocID = %q, want 16 hex digits", id)
+	}
+	if again := DocID("http://example.com/docs"); again != id {
+		t.Errorf("DocID changed from %q to %q", id, again)
+	}
+	if got := CanonicalURL("http://[::1"); got != "http://[::1" {
+		t.Errorf("CanonicalURL of an unparseable URL = %q, want it unchanged", got)
+	}
+}
+
+func TestSectionID(t *testing.T) {
+	page := "http://example.com/jobs"
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"fragment URL", DocID(page + "#cancel"), SectionID(page, "cancel"), true},
+		{"canonical page URL", SectionID("HTTP://Example.com:80/jobs", "cancel"), SectionID(page, "cancel"), true},
+		{"page URL with fragment", SectionID(page+"#other", "cancel"), SectionID(page, "cancel"), true},
+		{"other anchor", SectionID(page, "retries"), SectionID(page, "cancel"), false},
+		{"anchor case", SectionID(page, "Cancel"), SectionID(page, "cancel"), false},
+		{"section before the first heading", SectionID(page, ""), DocID(page), false},
+		{"other page", SectionID("http://example.com/other", "cancel"), SectionID(page, "cancel"), false},
+	}
+	for _, tt := range tests {
+		if same := tt.a == tt.b; same != tt.same {
+			t.Errorf("%s: IDs %s and %s equal is %v, want %v", tt.name, tt.a, tt.b, same, tt.same)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package index
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field identifies a separately indexed part of a document.
+type Field int
+
+const (
+	FieldTitle Field = iota
+	FieldHeading
+	FieldBody
+	FieldCode
+	numFields
+)
+
+var fieldNames = [numFields]string{"title", "heading", "body", "code"}
+
+// String returns the field name used in queries and configuration.
+func (f Field) String() string {
+	if f < 0 || f >= numFields {
+		return fmt.Sprintf("field(%d)", int(f))
+	}
+	return fieldNames[f]
+}
+
+// ParseField returns the field with the given name. "headings" and "text"
+// are accepted as aliases of heading and body.
+func ParseField(name string) (Field, bool) {
+	switch strings.ToLower(name) {
+	case "title":
+		return FieldTitle, true
+	case "heading", "headings":
+		return FieldHeading, true
+	case "body", "text":
+		return FieldBody, true
+	case "code":
+		return FieldCode, true
+	}
+	return 0, false
+}
+
+// Fields holds the parts of a document that are indexed separately.
+type Fields struct {
+	Title    string
+	Headings []string
+	Body     string
+	Code     []string
+}
+
+// text returns the content of field f.
+func (fs Fields) text(f Field) string {
+	switch f {
+	case FieldTitle:
+		return fs.Title
+	case FieldHeading:
+		return strings.Join(fs.Headings, "\n")
+	case FieldBody:
+		return fs.Body
+	case FieldCode:
+		return strings.Join(fs.Code, "\n")
+	}
+	return ""
+}
+
+// Ranking holds the parameters used to score search results: BM25's k1 and
+// b, and a boost per field so that matches in titles and headings count for
+// more than matches in body text.
+type Ranking struct {
+	K1     float64            // term frequency saturation
+	B      float64            // document length normalisation, 0..1
+	Boosts map[string]float64 // field name -> weight; missing fields weigh 1
+}
+
+// DefaultRanking returns the commonly used BM25 parameters and field boosts.
+func DefaultRanking() Ranking {
+	return Ranking{
+		K1: 1.2,
+		B:  0.75,
+		Boosts: map[string]float64{
+			"title":   3,
+			"heading": 2,
+			"body":    1,
+			"code":    1.5,
+		},
+	}
+}
+
+// Validate checks the parameters and field names.
+func (r Ranking) Validate() error {
+	if r.K1 < 0 {
+		return fmt.Errorf("k1 must not be negative")
+	}
+	if r.B < 0 || r.B > 1 {
+		return fmt.Errorf("b must be between 0 and 1")
+	}
+	for name, boost := range r.Boosts {
+		if _, ok := ParseField(name); !ok {
+			return fmt.Errorf("unknown field %q in boosts (want one of %s)", name, strings.Join(fieldNames[:], ", "))
+		}
+		if boost < 0 {
+			return fmt.Errorf("boost for field %q must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// boosts returns the per-field weights as an array indexed by Field.
+func (r Ranking) boosts() [numFields]float64 {
+	var out [numFields]float64
+	for f := range out {
+		out[f] = 1
+	}
+	for name, boost := range r.Boosts {
+		if f, ok := ParseField(name); ok {
+			out[f] = boost
+		}
+	}
+	return out
+}
@@ -0,0 +1,40 @@
+package index
+
+import "testing"
+
+func TestFoldDiacritics(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"cafe", "cafe"},
+		{"café", "cafe"},
+		{"straße", "strasse"},
+		{"æ", "ae"},
+		{"ǣ", "ae"},
+		{"ǽ", "ae"},
+		{"ø", "o"},
+		{"ǿ", "o"},
+		{"ſ", "s"},
+		{"ẛ", "s"},
+		{"việt", "viet"},
+		{"ёлка", "елка"},
+		{"ά", "α"},
+	}
+	for _, tt := range tests {
+		if got := foldDiacritics(tt.in); got != tt.want {
+			t.Errorf("foldDiacritics(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestFoldTableResolved checks that no entry folds to a letter that folds
+// further, so folding twice changes nothing.
+func TestFoldTableResolved(t *testing.T) {
+	for r, s := range foldTable {
+		for _, c := range s {
+			if t2, ok := foldTable[c]; ok {
+				t.Errorf("%q folds to %q, which contains %q folding to %q", r, s, c, t2)
+			}
+		}
+	}
+}
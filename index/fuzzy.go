@@ -0,0 +1,243 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFuzzyExpansions caps the dictionary terms a misspelt term expands to.
+const maxFuzzyExpansions = 10
+
+// maxEdits returns how many edits a term of n characters may be from a
+// dictionary term and still match it: none for very short terms, where
+// almost everything is one edit away, and at most two.
+func maxEdits(n int) int {
+	switch {
+	case n < 3:
+		return 0
+	case n < 6:
+		return 1
+	}
+	return 2
+}
+
+// fuzzyMatch is an indexed word close to a word of the query.
+type fuzzyMatch struct {
+	word string // the indexed word
+	term string // the term it was indexed as
+	dist int    // edit distance from the query word
+	df   int    // documents containing the term
+}
+
+// fuzzyTerms returns the terms of the indexed words within maxEdits of
+// word, closest and then most frequent first. Words are compared as
+// written rather than as terms, since stemming changes misspelt words
+// differently from correct ones. The word list is scanned with a distance
+// computation that gives up as soon as the bound is exceeded, which keeps
+// the scan cheap and needs no structure to maintain as documents change.
+// idx.mu must be held.
+func (idx *InvertedIndex) fuzzyTerms(word string) []fuzzyMatch {
+	a := []rune(word)
+	k := maxEdits(len(a))
+	if k == 0 {
+		return nil
+	}
+	best := make(map[string]fuzzyMatch)
+	for w, term := range idx.words {
+		if n := utf8.RuneCountInString(w); n < len(a)-k || n > len(a)+k || w == word {
+			continue
+		}
+		postings := idx.Index[term]
+		if len(postings) == 0 {
+			continue
+		}
+		d := editDistance(a, []rune(w), k)
+		if m, seen := best[term]; d > k || seen && (m.dist < d || m.dist == d && m.word < w) {
+			continue
+		}
+		best[term] = fuzzyMatch{word: w, term: term, dist: d, df: len(postings)}
+	}
+	matches := make([]fuzzyMatch, 0, len(best))
+	for _, m := range best {
+		matches = append(matches, m)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].dist != matches[j].dist {
+			return matches[i].dist < matches[j].dist
+		}
+		if matches[i].df != matches[j].df {
+			return matches[i].df > matches[j].df
+		}
+		return matches[i].term < matches[j].term
+	})
+	if len(matches) > maxFuzzyExpansions {
+		matches = matches[:maxFuzzyExpansions]
+	}
+	return matches
+}
+
+// editDistance returns the Damerau-Levenshtein distance between a and b
+// (insertions, deletions, substitutions and transpositions of adjacent
+// characters), or limit+1 if it exceeds limit.
+func editDistance(a, b []rune, limit int) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d := min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d = min(d, prev2[j-2]+1)
+			}
+			cur[j] = d
+			rowMin = min(rowMin, d)
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return min(prev[len(b)], limit+1)
+}
+
+// expandFuzzy returns c with every term that has no postings replaced by
+// its fuzzy matches, and whether any term was replaced. Matches are scored
+// lower the further they are from the term. Excluded terms are left alone.
+// idx.mu must be held.
+func (idx *InvertedIndex) expandFuzzy(c clause) (clause, bool) {
+	switch c := c.(type) {
+	case queryTerm:
+		matches := idx.missingTerm(c)
+		if len(matches) == 0 {
+			return c, false
+		}
+		alts := make(orClause, len(matches))
+		for i, m := range matches {
+			alts[i] = queryTerm{text: m.term, field: c.field, fuzz: m.dist}
+		}
+		if len(alts) == 1 {
+			return alts[0], true
+		}
+		return alts, true
+	case phraseClause:
+		return idx.expandSpan(c)
+	case nearClause:
+		left, lok := idx.expandSpan(c.left)
+		right, rok := idx.expandSpan(c.right)
+		return nearClause{left: left, right: right, dist: c.dist}, lok || rok
+	case andClause:
+		out := andClause{
+			required: make([]clause, len(c.required)),
+			optional: make([]clause, len(c.optional)),
+		}
+		var changed bool
+		for i, r := range c.required {
+			var ok bool
+			out.required[i], ok = idx.expandFuzzy(r)
+			changed = changed || ok
+		}
+		for i, o := range c.optional {
+			var ok bool
+			out.optional[i], ok = idx.expandFuzzy(o)
+			changed = changed || ok
+		}
+		return out, changed
+	case orClause:
+		out := make(orClause, len(c))
+		var changed bool
+		for i, o := range c {
+			var ok bool
+			out[i], ok = idx.expandFuzzy(o)
+			changed = changed || ok
+		}
+		return out, changed
+	}
+	return c, false
+}
+
+// expandSpan replaces missing terms of a NEAR operand or phrase by their
+// closest match, since those must stay single terms.
+func (idx *InvertedIndex) expandSpan(c spanClause) (spanClause, bool) {
+	switch c := c.(type) {
+	case queryTerm:
+		if matches := idx.missingTerm(c); len(matches) > 0 {
+			return queryTerm{text: matches[0].term, field: c.field, fuzz: matches[0].dist}, true
+		}
+	case phraseClause:
+		var changed bool
+		words := append([]string(nil), c.words...)
+		for i, w := range words {
+			if matches := idx.missingTerm(queryTerm{text: w, surface: c.surfaces[i]}); len(matches) > 0 {
+				words[i], changed = matches[0].term, true
+			}
+		}
+		c.words = words
+		return c, changed
+	}
+	return c, false
+}
+
+// missingTerm returns the fuzzy matches of t if it has no postings.
+func (idx *InvertedIndex) missingTerm(t queryTerm) []fuzzyMatch {
+	if len(idx.Index[t.text]) > 0 {
+		return nil
+	}
+	if t.surface == "" {
+		return idx.fuzzyTerms(t.text)
+	}
+	return idx.fuzzyTerms(t.surface)
+}
+
+// Suggest returns a corrected query, for "did you mean", when some of the
+// query's words are not in the index but close to words that are and the
+// corrected query has results. It returns nil otherwise.
+func (idx *InvertedIndex) Suggest(queryStr string) []string {
+	items, err := lexQuery(queryStr)
+	if err != nil {
+		return nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var (
+		b       strings.Builder
+		last    int
+		changed bool
+	)
+	for i, it := range items {
+		if it.kind != itemWord || isPrefix(it.text) || i > 0 && (items[i-1].kind == itemNot || items[i-1].kind == itemExclude) {
+			continue
+		}
+		tokens := idx.analyzer.tokenizeQuery(it.text)
+		if len(tokens) != 1 {
+			continue
+		}
+		matches := idx.missingTerm(queryTerm{text: tokens[0].text, surface: tokens[0].surface})
+		if len(matches) == 0 {
+			continue
+		}
+		b.WriteString(queryStr[last:it.off])
+		b.WriteString(matches[0].word)
+		last = it.off + len(it.text)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	b.WriteString(queryStr[last:])
+	corrected := b.String()
+	q, err := idx.parse(corrected)
+	if err != nil || len(idx.matchQuery(q)) == 0 {
+		return nil
+	}
+	return []string{corrected}
+}
@@ -0,0 +1,118 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 2, 3}, // gives up past the limit
+		{"connection", "connection", 2, 0},
+		{"conection", "connection", 2, 1}, // insertion
+		{"connnection", "connection", 2, 1},
+		{"cancle", "cancel", 2, 1}, // transposition
+		{"tset", "test", 1, 1},
+		{"", "abc", 5, 3},
+		{"café", "cafe", 1, 1}, // runes, not bytes
+	}
+	for _, tt := range tests {
+		if got := editDistance([]rune(tt.a), []rune(tt.b), tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestMaxEdits(t *testing.T) {
+	for n, want := range []int{0, 0, 0, 1, 1, 1, 2, 2, 2} {
+		if got := maxEdits(n); got != want {
+			t.Errorf("maxEdits(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestFuzzySearch(t *testing.T) {
+	idx := newTestIndex(
+		"Open a connection to the database.",
+		"Cancel a running task.",
+		"The scheduler retries failed tasks.",
+		"Set the timeout in the config file.",
+	)
+	tests := []struct {
+		query string
+		want  string // matching IDs, sorted
+	}{
+		{"conection", "doc1"},
+		{"databse", "doc1"},
+		{"cancle task", "doc2"},
+		{"schedular", "doc3"},
+		{"tasks", "doc2 doc3"},
+		{"taks", "doc2 doc3"},
+		{"fi", ""}, // too short to be corrected
+		{"fil", "doc4"},
+		{"timeout -confg", "doc4"}, // excluded words are not corrected
+		{`"cancle a runing task"`, "doc2"},
+		{"conection NEAR/3 databse", "doc1"},
+		{"xyzzy", ""},
+	}
+	for _, tt := range tests {
+		ids := searchIDs(t, idx, tt.query)
+		sort.Strings(ids)
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyOnlyForMissingTerms(t *testing.T) {
+	idx := newTestIndex("the config file", "the confix file")
+	tests := []struct {
+		query string
+		want  string // matching IDs, sorted
+	}{
+		{"config", "doc1"}, // indexed, so not expanded to confix
+		{"confiq", "doc1 doc2"},
+	}
+	for _, tt := range tests {
+		ids := searchIDs(t, idx, tt.query)
+		sort.Strings(ids)
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	idx := newTestIndex(
+		"Open a connection to the database.",
+		"Cancel a running task.",
+	)
+	tests := []struct {
+		query string
+		want  string // "" for no suggestion
+	}{
+		{"conection", "connection"},
+		{"open conection", "open connection"},
+		{"Cancle the task", "cancel the task"},
+		{"title:databse", ""}, // the corrected query has no results
+		{"title:databse OR cancle", "title:database OR cancel"},
+		{"databse OR cancle", "database OR cancel"},
+		{"connection", ""}, // nothing misspelt
+		{"databse -cancle", "database -cancle"},
+		{"conn*", ""},
+		{`"unterminated`, ""},
+		{"xyzzy", ""},
+	}
+	for _, tt := range tests {
+		got := strings.Join(idx.Suggest(tt.query), "|")
+		if got != tt.want {
+			t.Errorf("Suggest(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
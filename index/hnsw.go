@@ -0,0 +1,316 @@
+package index
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync"
+)
+
+// HNSWParams tunes the hierarchical navigable small world graph a
+// VectorIndex searches approximately.
+type HNSWParams struct {
+	// M is the number of links per node on each layer but the bottom one,
+	// which has twice as many. More links raise recall and memory use.
+	M int
+	// EfConstruction is the number of candidates considered when linking a
+	// new node. Larger values build a better graph, more slowly.
+	EfConstruction int
+	// EfSearch is the number of candidates considered when searching, at
+	// least the number of results asked for. Larger values raise recall
+	// and latency.
+	EfSearch int
+}
+
+// DefaultHNSWParams balances recall against speed. Recall@10 is about 0.98
+// on 20,000 random 64-dimensional vectors, which spread out more evenly,
+// and so are harder to search, than real embeddings; see TestHNSWRecall.
+var DefaultHNSWParams = HNSWParams{M: 16, EfConstruction: 200, EfSearch: 256}
+
+// Validate checks that the parameters can build a usable graph.
+func (p HNSWParams) Validate() error {
+	if p.M < 2 {
+		return errors.New("hnsw m must be at least 2")
+	}
+	if p.EfConstruction < 1 || p.EfSearch < 1 {
+		return errors.New("hnsw ef_construction and ef_search must be positive")
+	}
+	return nil
+}
+
+// hnswNode is a vector in the graph. Deleted nodes stay in the graph to
+// keep it connected, but are never returned.
+type hnswNode struct {
+	id      string
+	vec     []float32
+	links   [][]int32 // neighbors on each layer, from 0 up to the node's level
+	deleted bool
+}
+
+// hnsw is a hierarchical navigable small world graph (Malkov and Yashunin,
+// 2016) over unit vectors, navigated by dot product. Each node is linked to
+// its nearest neighbors on layer 0 and on a random number of sparser layers
+// above it; searches descend greedily from the top layer's entry point.
+type hnsw struct {
+	params   HNSWParams
+	nodes    []hnswNode
+	entry    int32 // -1 while empty
+	maxLevel int
+	deleted  int
+	rng      *rand.Rand
+}
+
+func newHNSW(params HNSWParams) *hnsw {
+	// A fixed seed makes builds reproducible.
+	return &hnsw{params: params, entry: -1, rng: rand.New(rand.NewPCG(1, 2))}
+}
+
+// candidate is a node and its similarity to the vector being searched for.
+type candidate struct {
+	node int32
+	sim  float64
+}
+
+// nearestFirst is a heap of candidates, most similar on top.
+type nearestFirst []candidate
+
+func (h nearestFirst) Len() int           { return len(h) }
+func (h nearestFirst) Less(i, j int) bool { return h[i].sim > h[j].sim }
+func (h nearestFirst) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *nearestFirst) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *nearestFirst) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// farthestFirst is a heap of candidates, least similar on top.
+type farthestFirst []candidate
+
+func (h farthestFirst) Len() int           { return len(h) }
+func (h farthestFirst) Less(i, j int) bool { return h[i].sim < h[j].sim }
+func (h farthestFirst) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *farthestFirst) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *farthestFirst) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+func (g *hnsw) sim(n int32, q []float32) float64 {
+	return dot(q, g.nodes[n].vec)
+}
+
+// maxLinks is the most neighbors a node keeps on layer l.
+func (g *hnsw) maxLinks(l int) int {
+	if l == 0 {
+		return 2 * g.params.M
+	}
+	return g.params.M
+}
+
+// randomLevel draws a node's top layer from an exponentially decaying
+// distribution, so each layer holds about 1/M of the nodes below it.
+func (g *hnsw) randomLevel() int {
+	return int(-math.Log(1-g.rng.Float64()) / math.Log(float64(g.params.M)))
+}
+
+// insert adds a node for a unit vector and returns its index.
+func (g *hnsw) insert(id string, vec []float32) int32 {
+	level := g.randomLevel()
+	n := int32(len(g.nodes))
+	g.nodes = append(g.nodes, hnswNode{id: id, vec: vec, links: make([][]int32, level+1)})
+	if g.entry < 0 {
+		g.entry, g.maxLevel = n, level
+		return n
+	}
+	ep := g.entry
+	for l := g.maxLevel; l > level; l-- {
+		ep = g.greedy(vec, ep, l)
+	}
+	eps := []candidate{{ep, g.sim(ep, vec)}}
+	for l := min(level, g.maxLevel); l >= 0; l-- {
+		found := g.searchLayer(vec, eps, g.params.EfConstruction, l, false)
+		neighbors := g.selectNeighbors(found, g.params.M)
+		links := make([]int32, len(neighbors))
+		for i, nb := range neighbors {
+			links[i] = nb.node
+			g.link(nb.node, n, l)
+		}
+		g.nodes[n].links[l] = links
+		eps = found
+	}
+	if level > g.maxLevel {
+		g.entry, g.maxLevel = n, level
+	}
+	return n
+}
+
+// link adds a link from one node to another on layer l, dropping the
+// least useful of the node's links if it has too many.
+func (g *hnsw) link(from, to int32, l int) {
+	links := append(g.nodes[from].links[l], to)
+	if len(links) > g.maxLinks(l) {
+		vec := g.nodes[from].vec
+		cands := make([]candidate, len(links))
+		for i, nb := range links {
+			cands[i] = candidate{nb, g.sim(nb, vec)}
+		}
+		sort.Slice(cands, func(i, j int) bool { return cands[i].sim > cands[j].sim })
+		kept := g.selectNeighbors(cands, g.maxLinks(l))
+		links = links[:len(kept)]
+		for i, c := range kept {
+			links[i] = c.node
+		}
+	}
+	g.nodes[from].links[l] = links
+}
+
+// selectNeighbors picks up to m of the candidates, sorted most similar
+// first, preferring ones that are closer to the new node than to any
+// neighbor already picked. That keeps links pointing in different
+// directions, which keeps clusters reachable from each other.
+func (g *hnsw) selectNeighbors(cands []candidate, m int) []candidate {
+	selected := make([]candidate, 0, m)
+	var skipped []candidate
+	for _, c := range cands {
+		if len(selected) == m {
+			break
+		}
+		diverse := true
+		for _, s := range selected {
+			if dot(g.nodes[c.node].vec, g.nodes[s.node].vec) > c.sim {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+	for _, c := range skipped {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+// greedy walks layer l from ep to the node most similar to q that has no
+// more similar neighbor.
+func (g *hnsw) greedy(q []float32, ep int32, l int) int32 {
+	cur, best := ep, g.sim(ep, q)
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range g.nodes[cur].links[l] {
+			if s := g.sim(nb, q); s > best {
+				cur, best, changed = nb, s, true
+			}
+		}
+	}
+	return cur
+}
+
+// searchLayer returns up to ef nodes of layer l most similar to q, most
+// similar first, found by a best-first walk from the entry points. If live
+// is set, deleted nodes are walked through but left out of the results, so
+// they do not take the places of live ones.
+func (g *hnsw) searchLayer(q []float32, eps []candidate, ef, l int, live bool) []candidate {
+	visited := getVisitSet(len(g.nodes))
+	defer visitSets.Put(visited)
+	var cands nearestFirst
+	var found farthestFirst
+	keep := func(c candidate) {
+		if live && g.nodes[c.node].deleted {
+			return
+		}
+		heap.Push(&found, c)
+		if found.Len() > ef {
+			heap.Pop(&found)
+		}
+	}
+	for _, e := range eps {
+		visited.visit(e.node)
+		heap.Push(&cands, e)
+		keep(e)
+	}
+	for cands.Len() > 0 {
+		c := heap.Pop(&cands).(candidate)
+		if found.Len() >= ef && c.sim < found[0].sim {
+			break // nothing left can improve the results
+		}
+		for _, nb := range g.nodes[c.node].links[l] {
+			if !visited.visit(nb) {
+				continue
+			}
+			s := g.sim(nb, q)
+			if found.Len() < ef || s > found[0].sim {
+				heap.Push(&cands, candidate{nb, s})
+				keep(candidate{nb, s})
+			}
+		}
+	}
+	out := []candidate(found)
+	sort.Slice(out, func(i, j int) bool { return out[i].sim > out[j].sim })
+	return out
+}
+
+// search returns up to k live nodes most similar to q, most similar first.
+func (g *hnsw) search(q []float32, k int) []candidate {
+	if g.entry < 0 {
+		return nil
+	}
+	ep := g.entry
+	for l := g.maxLevel; l > 0; l-- {
+		ep = g.greedy(q, ep, l)
+	}
+	found := g.searchLayer(q, []candidate{{ep, g.sim(ep, q)}}, max(g.params.EfSearch, k), 0, true)
+	return found[:min(k, len(found))]
+}
+
+// visitSet records the nodes a search has seen. Sets are reused across
+// searches, and clearing one only takes bumping its generation.
+type visitSet struct {
+	marks []uint32 // node -> generation it was last visited in
+	gen   uint32
+}
+
+var visitSets = sync.Pool{New: func() any { return new(visitSet) }}
+
+// getVisitSet returns an empty set for a graph of n nodes.
+func getVisitSet(n int) *visitSet {
+	v := visitSets.Get().(*visitSet)
+	if len(v.marks) < n {
+		v.marks = make([]uint32, n+n/4)
+		v.gen = 0
+	}
+	if v.gen++; v.gen == 0 {
+		clear(v.marks)
+		v.gen = 1
+	}
+	return v
+}
+
+// visit marks a node visited, reporting false if it already was.
+func (v *visitSet) visit(n int32) bool {
+	if v.marks[n] == v.gen {
+		return false
+	}
+	v.marks[n] = v.gen
+	return true
+}
+
+// remove marks a node deleted.
+func (g *hnsw) remove(n int32) {
+	if !g.nodes[n].deleted {
+		g.nodes[n].deleted = true
+		g.deleted++
+	}
+}
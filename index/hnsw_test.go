@@ -0,0 +1,219 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// randomVectors returns n vectors of dim normally distributed components,
+// which spread evenly over the sphere: a harder case for the graph than
+// real embeddings, which cluster.
+func randomVectors(r *rand.Rand, n, dim int) [][]float32 {
+	vecs := make([][]float32, n)
+	for i := range vecs {
+		vecs[i] = make([]float32, dim)
+		for j := range vecs[i] {
+			vecs[i][j] = float32(r.NormFloat64())
+		}
+	}
+	return vecs
+}
+
+// newRandomVectorIndex returns an index of n random vectors, with IDs their
+// positions.
+func newRandomVectorIndex(tb testing.TB, r *rand.Rand, n, dim int, params HNSWParams) *VectorIndex {
+	tb.Helper()
+	v := NewVectorIndex("test", params)
+	for i, vec := range randomVectors(r, n, dim) {
+		if err := v.Add(fmt.Sprint(i), vec); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return v
+}
+
+// recall returns the fraction of the exact k nearest neighbors of the
+// queries that Search finds.
+func recall(tb testing.TB, v *VectorIndex, queries [][]float32, k int) float64 {
+	tb.Helper()
+	found, total := 0, 0
+	for _, q := range queries {
+		got, err := v.Search(q, k)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		want := make(map[string]bool, k)
+		for _, n := range v.exactSearch(normalize(q), k) {
+			want[n.ID] = true
+		}
+		for _, n := range got {
+			if want[n.ID] {
+				found++
+			}
+		}
+		total += len(want)
+	}
+	return float64(found) / float64(total)
+}
+
+func TestHNSWRecall(t *testing.T) {
+	n := 20000
+	if testing.Short() {
+		n = 5000
+	}
+	const dim, k, minRecall = 64, 10, 0.95
+	r := rand.New(rand.NewPCG(1, 2))
+	v := newRandomVectorIndex(t, r, n, dim, DefaultHNSWParams)
+	queries := randomVectors(r, 100, dim)
+	if got := recall(t, v, queries, k); got < minRecall {
+		t.Errorf("recall@%d of %d vectors = %.3f, want at least %.2f", k, n, got, minRecall)
+	}
+
+	// Deleted nodes stay in the graph as waypoints; results must not
+	// suffer from them, nor include them.
+	for i := 0; i < n/4; i++ {
+		v.Remove(fmt.Sprint(4 * i))
+	}
+	if got := recall(t, v, queries, k); got < minRecall {
+		t.Errorf("recall@%d after deleting a quarter = %.3f, want at least %.2f", k, got, minRecall)
+	}
+	for _, q := range queries {
+		got, _ := v.Search(q, k)
+		for _, nb := range got {
+			if v.graph.nodes[v.ids[nb.ID]].deleted || !v.Has(nb.ID) {
+				t.Fatalf("Search returned deleted document %s", nb.ID)
+			}
+		}
+	}
+}
+
+// TestHNSWSearchSkipsDeleted deletes the nearest neighbors of a query, so
+// that they would fill every one of the EfSearch places if deleted nodes
+// were kept among the candidates.
+func TestHNSWSearchSkipsDeleted(t *testing.T) {
+	const n, dim, k = 300, 8, 5
+	r := rand.New(rand.NewPCG(3, 4))
+	v := newRandomVectorIndex(t, r, n, dim, HNSWParams{M: 8, EfConstruction: 100, EfSearch: k})
+	q := normalize(randomVectors(r, 1, dim)[0])
+	for _, nb := range v.exactSearch(q, 4*k) {
+		v.Remove(nb.ID)
+	}
+	want := v.exactSearch(q, k)
+	got := v.graph.search(q, k)
+	if len(got) != k {
+		t.Fatalf("search found %d nodes, want %d", len(got), k)
+	}
+	for i, c := range got {
+		if node := v.graph.nodes[c.node]; node.deleted {
+			t.Errorf("search returned deleted node %s", node.id)
+		} else if i == 0 && node.id != want[0].ID {
+			t.Errorf("search found %s first, want %s", node.id, want[0].ID)
+		}
+	}
+}
+
+func TestVectorIndexExactBelowThreshold(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	v := newRandomVectorIndex(t, r, exactSearchMax, 16, DefaultHNSWParams)
+	if got := recall(t, v, randomVectors(r, 20, 16), 10); got != 1 {
+		t.Errorf("recall@10 at %d vectors = %.3f, want 1 from exact search", exactSearchMax, got)
+	}
+}
+
+func TestVectorIndexSaveLoad(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6))
+	v := newRandomVectorIndex(t, r, 3000, 16, DefaultHNSWParams)
+	v.Remove("7")
+	path := t.TempDir() + "/vectors.json"
+	if err := v.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadVectorIndex(path, "test", DefaultHNSWParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != v.Len() || loaded.Has("7") {
+		t.Fatalf("loaded %d vectors (has 7: %v), want %d without 7", loaded.Len(), loaded.Has("7"), v.Len())
+	}
+	q := randomVectors(r, 1, 16)[0]
+	want, _ := v.Search(q, 10)
+	got, _ := loaded.Search(q, 10)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("loaded index found %v, want %v", got, want)
+	}
+
+	other, err := LoadVectorIndex(path, "other model", DefaultHNSWParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Len() != 0 {
+		t.Errorf("index loaded for another model has %d vectors, want 0", other.Len())
+	}
+}
+
+func TestLoadVectorIndexMalformedGraph(t *testing.T) {
+	vec := encodeVector([]float32{1, 0})
+	tests := []struct {
+		name     string
+		maxLevel int
+		links    [][][]int32 // per node
+		wantErr  string
+	}{
+		{"valid", 1, [][][]int32{{{1}, {}}, {{0}}}, ""},
+		{"no layers", 0, [][][]int32{{{}}, {}}, "0 link layers"},
+		{"above the top layer", 0, [][][]int32{{{1}}, {{0}, {}}}, "2 link layers"},
+		{"link to a lower node", 1, [][][]int32{{{1}, {1}}, {{0}}}, "on layer 1 to a node below it"},
+		{"link out of range", 0, [][][]int32{{{1}}, {{2}}}, "link out of range"},
+		{"entry below the top layer", 1, [][][]int32{{{1}}, {{0}}}, "invalid entry point"},
+	}
+	for _, tt := range tests {
+		g := graphFile{M: DefaultHNSWParams.M, EfConstruction: DefaultHNSWParams.EfConstruction, MaxLevel: tt.maxLevel}
+		for i, links := range tt.links {
+			g.Nodes = append(g.Nodes, nodeFile{ID: fmt.Sprint(i), Vector: vec, Links: links})
+		}
+		data, err := json.Marshal(vectorFile{FormatVersion: VectorFormatVersion, Model: "test", Dim: 2, Graph: &g})
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "vectors.json")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err = LoadVectorIndex(path, "test", DefaultHNSWParams)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: LoadVectorIndex error %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// BenchmarkVectorSearch compares searching the graph with comparing the
+// query with every vector, at the size from which Search uses the graph
+// and well above it.
+func BenchmarkVectorSearch(b *testing.B) {
+	const dim, k = 64, 10
+	for _, n := range []int{exactSearchMax + 1, 20000} {
+		r := rand.New(rand.NewPCG(1, 2))
+		v := newRandomVectorIndex(b, r, n, dim, DefaultHNSWParams)
+		queries := randomVectors(r, 100, dim)
+		for i, q := range queries {
+			queries[i] = normalize(q)
+		}
+		r10 := recall(b, v, queries, k)
+		b.Run(fmt.Sprintf("hnsw/n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				v.graph.search(queries[i%len(queries)], k)
+			}
+			b.ReportMetric(r10, "recall")
+		})
+		b.Run(fmt.Sprintf("exact/n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				v.exactSearch(queries[i%len(queries)], k)
+			}
+		})
+	}
+}
@@ -1,153 +1,445 @@
 package index
 
 import (
-	"strconv"
+	"math"
+	"sort"
 	"strings"
 	"sync"
+	"unicode/utf8"
+
+	"github.com/deepersensor/documcp/docstore"
 )
 
-// Document represents a crawled document to be indexed.
-type Document struct {
-	ID    string
-	URL   string
-	Title string
-	Text  string
+// DocumentStore holds the documents an InvertedIndex indexes. The index
+// keeps only postings and looks documents up in the store, so every
+// search result is the full stored record.
+type DocumentStore interface {
+	Get(id string) (*docstore.Document, bool)
+	All() []*docstore.Document
+}
+
+// FieldsOf returns the fields of a document that are indexed. A section is
+// found by its heading path rather than by headings of its own.
+func FieldsOf(d *docstore.Document) Fields {
+	headings := d.Headings
+	if d.IsSection() {
+		headings = d.Path
+	}
+	return Fields{Title: d.Title, Headings: headings, Body: d.Text, Code: d.CodeSnippets}
+}
+
+// SearchResult is a document matching a query with its relevance score.
+type SearchResult struct {
+	*docstore.Document
+	Score float64
+}
+
+// Posting records the positions at which a term occurs in each field of one
+// document, in ascending order.
+type Posting struct {
+	Pos [numFields][]int `json:"pos"`
 }
 
-// InvertedIndex is a simple in-memory full-text index.
+// tf returns the number of times the term occurs in field f.
+func (p *Posting) tf(f Field) int {
+	return len(p.Pos[f])
+}
+
+// InvertedIndex is a simple in-memory full-text index over the documents of
+// a DocumentStore.
 type InvertedIndex struct {
 	mu        sync.RWMutex
-	Docs      map[string]Document
-	Index     map[string]map[string]struct{} // term -> set of doc IDs
-	nextDocID int
+	store     DocumentStore
+	Index     map[string]map[string]*Posting // term -> doc ID -> posting
+	docTerms  map[string][]string            // doc ID -> terms it has postings for
+	docLen    map[string][numFields]int      // doc ID -> tokens per field
+	totalLen  [numFields]int
+	ranking   Ranking
+	boosts    [numFields]float64
+	analyzer  *Analyzer
+	words     map[string]string   // word as written (lower-cased) -> term
+	termWords map[string][]string // term -> words that led to it
+	wordList  wordList            // sorted words, for prefix queries
 }
 
-// NewInvertedIndex creates a new empty index.
-func NewInvertedIndex() *InvertedIndex {
+// NewInvertedIndex creates a new empty index over the documents of store.
+func NewInvertedIndex(store DocumentStore) *InvertedIndex {
+	r := DefaultRanking()
+	a, _ := NewAnalyzer(DefaultAnalyzer)
 	return &InvertedIndex{
-		Docs:  make(map[string]Document),
-		Index: make(map[string]map[string]struct{}),
+		store:     store,
+		Index:     make(map[string]map[string]*Posting),
+		docTerms:  make(map[string][]string),
+		docLen:    make(map[string][numFields]int),
+		ranking:   r,
+		boosts:    r.boosts(),
+		analyzer:  a,
+		words:     make(map[string]string),
+		termWords: make(map[string][]string),
+	}
+}
+
+// SetRanking changes the BM25 parameters and field boosts used by Search.
+func (idx *InvertedIndex) SetRanking(r Ranking) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.ranking = r
+	idx.boosts = r.boosts()
+}
+
+// Analyzer returns the analyzer the index was built with.
+func (idx *InvertedIndex) Analyzer() *Analyzer {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.analyzer
+}
+
+// SetAnalyzer changes the analyzer used for documents and queries,
+// re-indexing every document if it differs from the current one.
+func (idx *InvertedIndex) SetAnalyzer(a *Analyzer) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.analyzer.Equal(a) {
+		return
 	}
+	idx.analyzer = a
+	idx.rebuild()
+}
+
+// Put indexes a document under its ID, replacing whatever was indexed
+// under that ID. The document should be in the index's store, or it is
+// left out of search results.
+func (idx *InvertedIndex) Put(d *docstore.Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeDocument(d.ID)
+	idx.addPostings(d.ID, FieldsOf(d))
 }
 
-// AddDocument indexes a new document.
-func (idx *InvertedIndex) AddDocument(url, title, text string) string {
+// RemoveDocument removes a document's postings from the index, reporting
+// whether it was indexed.
+func (idx *InvertedIndex) RemoveDocument(id string) bool {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
-	docID := idx.generateDocID()
-	doc := Document{
-		ID:    docID,
-		URL:   url,
-		Title: title,
-		Text:  text,
+	return idx.removeDocument(id)
+}
+
+// removeDocument deletes the postings of a document. Terms left without
+// postings are dropped, along with the words that led to them, so prefix
+// and fuzzy lookups no longer offer them.
+func (idx *InvertedIndex) removeDocument(id string) bool {
+	lengths, ok := idx.docLen[id]
+	if !ok {
+		return false
 	}
-	idx.Docs[docID] = doc
-	for _, term := range tokenize(text) {
-		if idx.Index[term] == nil {
-			idx.Index[term] = make(map[string]struct{})
+	for _, term := range idx.docTerms[id] {
+		if postings := idx.Index[term]; postings != nil {
+			delete(postings, id)
+			if len(postings) == 0 {
+				delete(idx.Index, term)
+				idx.dropWords(term)
+			}
 		}
-		idx.Index[term][docID] = struct{}{}
 	}
-	return docID
+	for f := range lengths {
+		idx.totalLen[f] -= lengths[f]
+	}
+	delete(idx.docTerms, id)
+	delete(idx.docLen, id)
+	return true
 }
 
-// Search returns document IDs matching all terms.
-func (idx *InvertedIndex) Search(query string) []Document {
+// dropWords forgets the words that led to a term.
+func (idx *InvertedIndex) dropWords(term string) {
+	for _, w := range idx.termWords[term] {
+		if idx.words[w] == term {
+			delete(idx.words, w)
+		}
+	}
+	delete(idx.termWords, term)
+	idx.wordList.invalidate()
+}
+
+// addWord records that a word as written leads to a term.
+func (idx *InvertedIndex) addWord(word, term string) {
+	if idx.words[word] == term {
+		return
+	}
+	idx.words[word] = term
+	idx.termWords[term] = append(idx.termWords[term], word)
+	idx.wordList.invalidate()
+}
+
+// addPostings records per-field term positions and lengths of a document.
+func (idx *InvertedIndex) addPostings(docID string, fields Fields) {
+	var lengths [numFields]int
+	var terms []string
+	for f := Field(0); f < numFields; f++ {
+		tokens := idx.analyzer.tokenize(fields.text(f))
+		for _, tok := range tokens {
+			postings := idx.Index[tok.text]
+			if postings == nil {
+				postings = make(map[string]*Posting)
+				idx.Index[tok.text] = postings
+			}
+			p := postings[docID]
+			if p == nil {
+				p = &Posting{}
+				postings[docID] = p
+				terms = append(terms, tok.text)
+			}
+			p.Pos[f] = append(p.Pos[f], tok.pos)
+			idx.addWord(tok.surface, tok.text)
+		}
+		lengths[f] = len(tokens)
+		idx.totalLen[f] += len(tokens)
+	}
+	idx.docLen[docID] = lengths
+	idx.docTerms[docID] = terms
+}
+
+// Search returns documents matching the query, ranked by BM25F score with
+// the best match first. Terms are ANDed by default; the query may also use
+// OR, NOT or -term, +required terms, parentheses, "quoted phrases",
+// proximity (pool NEAR/3 connection), prefixes (conf*) and field
+// restrictions such as heading:install; see parseQuery. A malformed query
+// returns a *SyntaxError.
+//
+// Words missing from the index match the indexed words closest to them
+// instead, so typos still find documents. Documents matching the query as
+// typed rank above those found this way.
+func (idx *InvertedIndex) Search(queryStr string) ([]SearchResult, error) {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
-	terms := tokenize(query)
-	if len(terms) == 0 {
+	q, err := idx.parse(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	exact := idx.matchQuery(q)
+	resultIDs := exact
+	if fq, ok := idx.expandFuzzy(q); ok {
+		q = fq
+		resultIDs = idx.matchQuery(q)
+		for id := range exact {
+			resultIDs[id] = struct{}{}
+		}
+	}
+	if len(resultIDs) == 0 {
+		return nil, nil
+	}
+	terms := q.terms()
+	results := make([]SearchResult, 0, len(resultIDs))
+	for id := range resultIDs {
+		if d, ok := idx.store.Get(id); ok {
+			results = append(results, SearchResult{Document: d, Score: idx.score(id, terms)})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		_, ei := exact[results[i].ID]
+		_, ej := exact[results[j].ID]
+		if ei != ej {
+			return ei
+		}
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	return results, nil
+}
+
+// parse parses a query and expands its prefixes against the index.
+// idx.mu must be held.
+func (idx *InvertedIndex) parse(queryStr string) (clause, error) {
+	q, err := parseQuery(queryStr, idx.analyzer)
+	if err != nil || q == nil {
+		return nil, err
+	}
+	return idx.expandPrefixes(q), nil
+}
+
+// matchQuery returns the IDs of documents matching the query. Candidates are
+// found from the postings first, then each is checked against the whole
+// query including term positions.
+func (idx *InvertedIndex) matchQuery(q clause) map[string]struct{} {
+	if q == nil {
 		return nil
 	}
-	var resultIDs map[string]struct{}
-	for i, term := range terms {
-		docSet, ok := idx.Index[term]
-		if !ok {
-			return nil
+	resultIDs, all := idx.candidates(q)
+	if all {
+		resultIDs = make(map[string]struct{}, len(idx.docLen))
+		for id := range idx.docLen {
+			resultIDs[id] = struct{}{}
 		}
-		if i == 0 {
-			resultIDs = make(map[string]struct{}, len(docSet))
-			for id := range docSet {
-				resultIDs[id] = struct{}{}
+	}
+	for id := range resultIDs {
+		get := func(term string) *Posting { return idx.Index[term][id] }
+		if !q.match(get) {
+			delete(resultIDs, id)
+		}
+	}
+	return resultIDs
+}
+
+// candidates returns a superset of the IDs of documents matching c. all is
+// set instead when the postings cannot narrow c down, as for NOT.
+func (idx *InvertedIndex) candidates(c clause) (ids map[string]struct{}, all bool) {
+	switch c := c.(type) {
+	case queryTerm, phraseClause:
+		return idx.matchAll(c.terms()), false
+	case prefixClause:
+		return nil, false
+	case anyTerm:
+		ids := make(map[string]struct{})
+		for _, t := range c {
+			for id := range idx.matchAll([]queryTerm{t}) {
+				ids[id] = struct{}{}
 			}
-		} else {
-			for id := range resultIDs {
-				if _, ok := docSet[id]; !ok {
-					delete(resultIDs, id)
-				}
+		}
+		return ids, false
+	case nearClause:
+		left, _ := idx.candidates(c.left)
+		right, _ := idx.candidates(c.right)
+		return intersect([]map[string]struct{}{left, right}), false
+	case andClause:
+		var sets []map[string]struct{}
+		for _, r := range c.required {
+			if ids, all := idx.candidates(r); !all {
+				sets = append(sets, ids)
 			}
 		}
+		if len(sets) > 0 {
+			return intersect(sets), false
+		}
+		if len(c.required) > 0 || len(c.optional) == 0 {
+			return nil, true
+		}
+		return idx.candidates(orClause(c.optional))
+	case orClause:
+		ids := make(map[string]struct{})
+		for _, o := range c {
+			sub, all := idx.candidates(o)
+			if all {
+				return nil, true
+			}
+			for id := range sub {
+				ids[id] = struct{}{}
+			}
+		}
+		return ids, false
 	}
-	var results []Document
-	for id := range resultIDs {
-		results = append(results, idx.Docs[id])
-	}
-	return results
+	return nil, true
 }
 
-// GetDocument returns a document by its ID.
-func (idx *InvertedIndex) GetDocument(id string) (Document, bool) {
-	idx.mu.RLock()
-	defer idx.mu.RUnlock()
-	doc, ok := idx.Docs[id]
-	return doc, ok
+// intersect returns the IDs present in every set, reusing the smallest.
+func intersect(sets []map[string]struct{}) map[string]struct{} {
+	sort.Slice(sets, func(i, j int) bool { return len(sets[i]) < len(sets[j]) })
+	ids := sets[0]
+	for id := range ids {
+		for _, s := range sets[1:] {
+			if _, ok := s[id]; !ok {
+				delete(ids, id)
+				break
+			}
+		}
+	}
+	return ids
 }
 
-// SearchSentences returns all sentences from indexed documents that match the query.
-func (idx *InvertedIndex) SearchSentences(query string) []string {
-	idx.mu.RLock()
-	defer idx.mu.RUnlock()
-	terms := tokenize(query)
+// matchAll returns the IDs of documents containing every term.
+func (idx *InvertedIndex) matchAll(terms []queryTerm) map[string]struct{} {
 	if len(terms) == 0 {
 		return nil
 	}
 	var resultIDs map[string]struct{}
-	for i, term := range terms {
-		docSet, ok := idx.Index[term]
+	for i, t := range terms {
+		postings, ok := idx.Index[t.text]
 		if !ok {
 			return nil
 		}
 		if i == 0 {
-			resultIDs = make(map[string]struct{}, len(docSet))
-			for id := range docSet {
-				resultIDs[id] = struct{}{}
+			resultIDs = make(map[string]struct{}, len(postings))
+			for id, p := range postings {
+				if t.matches(p) {
+					resultIDs[id] = struct{}{}
+				}
 			}
 		} else {
 			for id := range resultIDs {
-				if _, ok := docSet[id]; !ok {
+				if p, ok := postings[id]; !ok || !t.matches(p) {
 					delete(resultIDs, id)
 				}
 			}
 		}
 	}
+	return resultIDs
+}
+
+// score computes the BM25F score of a document for the query terms: field
+// frequencies are length-normalised and boosted per field, summed, and then
+// saturated once per term.
+func (idx *InvertedIndex) score(docID string, terms []queryTerm) float64 {
+	n := float64(len(idx.docLen))
+	k1, b := idx.ranking.K1, idx.ranking.B
+	lengths := idx.docLen[docID]
+	var norm [numFields]float64
+	for f := range norm {
+		avgLen := 1.0
+		if len(idx.docLen) > 0 {
+			avgLen = math.Max(float64(idx.totalLen[f])/float64(len(idx.docLen)), 1)
+		}
+		norm[f] = 1 - b + b*float64(lengths[f])/avgLen
+	}
+	var score float64
+	for _, t := range terms {
+		postings := idx.Index[t.text]
+		p := postings[docID]
+		if p == nil {
+			continue
+		}
+		var tf float64
+		for f := Field(0); f < numFields; f++ {
+			if p.tf(f) == 0 || (t.field >= 0 && t.field != f) {
+				continue
+			}
+			tf += idx.boosts[f] * float64(p.tf(f)) / norm[f]
+		}
+		if tf == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		score += idf * tf * (k1 + 1) / (tf + k1) / float64(1+t.fuzz)
+	}
+	return score
+}
+
+// SearchSentences returns all sentences from indexed documents that match the query.
+func (idx *InvertedIndex) SearchSentences(queryStr string) ([]string, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	q, err := idx.parse(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	if fq, ok := idx.expandFuzzy(q); ok {
+		q = fq
+	}
+	resultIDs := idx.matchQuery(q)
 	var sentences []string
 	for id := range resultIDs {
-		doc := idx.Docs[id]
+		doc, ok := idx.store.Get(id)
+		if !ok {
+			continue
+		}
 		// Split text into sentences (simple heuristic)
 		for _, s := range tokenizeSentences(doc.Text) {
-			if containsAllTerms(s, terms) {
+			if q.match(idx.sentencePostings(s)) {
 				sentences = append(sentences, s)
 			}
 		}
 	}
-	return sentences
-}
-
-// generateDocID returns a new unique document ID.
-func (idx *InvertedIndex) generateDocID() string {
-	idx.nextDocID++
-	return "doc" + strconv.Itoa(idx.nextDocID)
-}
-
-// tokenize splits text into lowercase words.
-func tokenize(text string) []string {
-	words := strings.FieldsFunc(text, func(r rune) bool {
-		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
-	})
-	for i, w := range words {
-		words[i] = strings.ToLower(w)
-	}
-	return words
+	return sentences, nil
 }
 
 // Helper to split text into sentences (simple heuristic).
@@ -157,13 +449,13 @@ func tokenizeSentences(text string) []string {
 	sentences := []string{}
 	start := 0
 	for i, r := range text {
-		if r == '.' || r == '!' || r == '?' {
-			s := text[start : i+1]
+		if isSentenceEnd(r) {
+			s := text[start : i+utf8.RuneLen(r)]
 			s = strings.TrimSpace(s)
 			if s != "" {
 				sentences = append(sentences, s)
 			}
-			start = i + 1
+			start = i + utf8.RuneLen(r)
 		}
 	}
 	// Add any trailing text
@@ -176,13 +468,33 @@ func tokenizeSentences(text string) []string {
 	return sentences
 }
 
-// Helper to check if all terms are in the sentence.
-func containsAllTerms(s string, terms []string) bool {
-	s = strings.ToLower(s)
-	for _, t := range terms {
-		if !strings.Contains(s, t) {
-			return false
+// isSentenceEnd reports whether r ends a sentence, including the CJK
+// full-width punctuation that is not followed by a space.
+func isSentenceEnd(r rune) bool {
+	switch r {
+	case '.', '!', '?', '。', '！', '？':
+		return true
+	}
+	return false
+}
+
+// sentencePostings indexes a single sentence for matching. Field
+// restrictions are checked at the document level, so the sentence's
+// positions are visible in every field.
+func (idx *InvertedIndex) sentencePostings(s string) postingFunc {
+	postings := make(map[string]*Posting)
+	for _, tok := range idx.analyzer.tokenize(s) {
+		p := postings[tok.text]
+		if p == nil {
+			p = &Posting{}
+			postings[tok.text] = p
 		}
+		p.Pos[FieldBody] = append(p.Pos[FieldBody], tok.pos)
 	}
-	return true
+	for _, p := range postings {
+		for f := range p.Pos {
+			p.Pos[f] = p.Pos[FieldBody]
+		}
+	}
+	return func(term string) *Posting { return postings[term] }
 }
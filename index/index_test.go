@@ -0,0 +1,222 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/deepersensor/documcp/docstore"
+)
+
+// newTestIndex indexes one document per text; the i-th text gets the ID
+// "doc<i+1>".
+func newTestIndex(texts ...string) *InvertedIndex {
+	idx := NewInvertedIndex(docstore.NewStore())
+	for i, text := range texts {
+		putFields(idx, fmt.Sprintf("doc%d", i+1), "http://example.com/"+text, Fields{Body: text})
+	}
+	return idx
+}
+
+// putFields stores a document with the given fields in the index's store
+// and indexes it.
+func putFields(idx *InvertedIndex, id, url string, f Fields) {
+	d := docstore.NewDocument(id, url, f.Title, f.Body, f.Headings, f.Code, nil, 1)
+	idx.store.(*docstore.Store).Put(d)
+	idx.Put(d)
+}
+
+// searchIDs returns the IDs of the documents matching query, best first.
+func searchIDs(t *testing.T, idx *InvertedIndex, query string) []string {
+	t.Helper()
+	results, err := idx.Search(query)
+	if err != nil {
+		t.Fatalf("Search(%q): %v", query, err)
+	}
+	var ids []string
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestBM25Ranking(t *testing.T) {
+	tests := []struct {
+		name    string
+		ranking Ranking
+		texts   []string
+		query   string
+		want    string // IDs, best first
+		equal   bool   // all scores equal
+	}{
+		{
+			name:    "more occurrences rank higher",
+			ranking: Ranking{K1: 1.2, B: 0},
+			texts:   []string{"cat", "cat cat cat cat cat cat cat cat", "cat cat"},
+			query:   "cat",
+			want:    "doc2 doc3 doc1",
+		},
+		{
+			name:    "k1 0 ignores term frequency",
+			ranking: Ranking{K1: 0, B: 0},
+			texts:   []string{"cat", "cat cat cat cat cat cat cat cat", "cat cat"},
+			query:   "cat",
+			want:    "doc1 doc2 doc3",
+			equal:   true,
+		},
+		{
+			name:    "shorter documents rank higher",
+			ranking: Ranking{K1: 1.2, B: 0.75},
+			texts:   []string{"cat dog bird fish mouse horse owl", "cat dog"},
+			query:   "cat",
+			want:    "doc2 doc1",
+		},
+		{
+			name:    "b 0 ignores document length",
+			ranking: Ranking{K1: 1.2, B: 0},
+			texts:   []string{"cat dog bird fish mouse horse owl", "cat dog"},
+			query:   "cat",
+			want:    "doc1 doc2",
+			equal:   true,
+		},
+	}
+	for _, tt := range tests {
+		idx := newTestIndex(tt.texts...)
+		idx.SetRanking(tt.ranking)
+		results, err := idx.Search(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(searchIDs(t, idx, tt.query), " "); got != tt.want {
+			t.Errorf("%s: Search(%q) = %q, want %q", tt.name, tt.query, got, tt.want)
+		}
+		for i := 1; i < len(results); i++ {
+			if results[i].Score > results[i-1].Score {
+				t.Errorf("%s: scores not descending: %v", tt.name, results)
+			}
+			if equal := results[i].Score == results[0].Score; equal != tt.equal {
+				t.Errorf("%s: scores %v, want equal %v", tt.name, results, tt.equal)
+			}
+		}
+	}
+}
+
+func TestBM25RareTermsWeighMore(t *testing.T) {
+	idx := newTestIndex("apple zebra", "apple kiwi", "apple plum")
+	rare, _ := idx.Search("zebra")
+	common, _ := idx.Search("apple")
+	if len(rare) != 1 || len(common) != 3 {
+		t.Fatalf("got %d and %d results, want 1 and 3", len(rare), len(common))
+	}
+	if rare[0].Score <= common[0].Score {
+		t.Errorf("score of a rare term %.3f, want above the common term's %.3f", rare[0].Score, common[0].Score)
+	}
+}
+
+func TestBM25Saturation(t *testing.T) {
+	idx := newTestIndex("cat", "cat cat", "cat cat cat", strings.Repeat("cat ", 50), "dog")
+	idx.SetRanking(Ranking{K1: 1.2, B: 0})
+	scores := make(map[string]float64)
+	results, err := idx.Search("cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		scores[r.ID] = r.Score
+	}
+	// Each further occurrence adds less than the one before.
+	if gain1, gain2 := scores["doc2"]-scores["doc1"], scores["doc3"]-scores["doc2"]; gain2 >= gain1 {
+		t.Errorf("gains %.3f then %.3f, want term frequency to saturate", gain1, gain2)
+	}
+	// No number of occurrences scores idf*(k1+1) or more.
+	idf := math.Log(1 + (5-4+0.5)/(4+0.5))
+	if limit := idf * 2.2; scores["doc4"] >= limit {
+		t.Errorf("score %.3f, want below the saturation limit %.3f", scores["doc4"], limit)
+	}
+}
+
+func TestFieldBoosts(t *testing.T) {
+	tests := []struct {
+		name   string
+		boosts map[string]float64
+		want   string // IDs, best first
+	}{
+		{name: "default boosts", boosts: DefaultRanking().Boosts, want: "doc1 doc2 doc3"},
+		{name: "heading above title", boosts: map[string]float64{"title": 1, "heading": 4, "body": 1}, want: "doc2 doc1 doc3"},
+		{name: "body above both", boosts: map[string]float64{"title": 0.5, "heading": 0.5, "body": 4}, want: "doc3 doc1 doc2"},
+	}
+	for _, tt := range tests {
+		idx := NewInvertedIndex(docstore.NewStore())
+		putFields(idx, "doc1", "http://example.com/title", Fields{Title: "Install", Body: "Run the setup script."})
+		putFields(idx, "doc2", "http://example.com/heading", Fields{Headings: []string{"Install"}, Body: "Run the setup script."})
+		putFields(idx, "doc3", "http://example.com/body", Fields{Body: "Install and run the script."})
+		r := DefaultRanking()
+		r.Boosts = tt.boosts
+		idx.SetRanking(r)
+		if got := strings.Join(searchIDs(t, idx, "install"), " "); got != tt.want {
+			t.Errorf("%s: Search(install) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFieldQuery(t *testing.T) {
+	idx := NewInvertedIndex(docstore.NewStore())
+	putFields(idx, "doc1", "http://example.com/a", Fields{Title: "Install", Body: "Configure the pool."})
+	putFields(idx, "doc2", "http://example.com/b", Fields{Title: "Configure", Body: "Install the package."})
+	tests := []struct {
+		query, want string
+	}{
+		{"install", "doc1 doc2"},
+		{"title:install", "doc1"},
+		{"body:install", "doc2"},
+		{"title:configure body:install", "doc2"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(searchIDs(t, idx, tt.query), " "); got != tt.want {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRemoveAndReplaceDocument(t *testing.T) {
+	idx := newTestIndex("red car", "blue car", "red bus")
+	if !idx.RemoveDocument("doc1") || idx.RemoveDocument("doc1") {
+		t.Error("RemoveDocument should report doc1 removed once")
+	}
+	putFields(idx, "doc3", "http://example.com/green", Fields{Body: "green bus"})
+	tests := []struct {
+		query, want string
+	}{
+		{"car", "doc2"},
+		{"red", ""},
+		{"green", "doc3"},
+		{"bus", "doc3"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(searchIDs(t, idx, tt.query), " "); got != tt.want {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+	if _, ok := idx.Index["red"]; ok {
+		t.Error("term red kept postings after its documents went")
+	}
+	for _, w := range []string{"red", "bus"} {
+		_, ok := idx.words[w]
+		if want := w == "bus"; ok != want {
+			t.Errorf("word %q indexed is %v, want %v", w, ok, want)
+		}
+	}
+	if words, _ := idx.Complete("re", 10); len(words) != 0 {
+		t.Errorf("Complete(re) = %q after red went, want nothing", words)
+	}
+	if got := idx.Suggest("rad"); len(got) != 0 {
+		t.Errorf("Suggest(rad) = %q after red went, want nothing", got)
+	}
+	if _, ok := idx.docLen["doc1"]; ok || idx.docTerms["doc1"] != nil {
+		t.Error("doc1 is still indexed")
+	}
+	if want := [numFields]int{FieldBody: 4}; idx.totalLen != want {
+		t.Errorf("total field lengths %v, want %v", idx.totalLen, want)
+	}
+}
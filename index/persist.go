@@ -0,0 +1,122 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/deepersensor/documcp/internal"
+)
+
+// FormatVersion is the version of the on-disk index format written by Save.
+const FormatVersion = 1
+
+// indexFile is the on-disk representation of an InvertedIndex.
+type indexFile struct {
+	FormatVersion int                            `json:"format_version"`
+	Analyzer      []string                       `json:"analyzer"` // filter names
+	Postings      map[string]map[string]*Posting `json:"postings"` // term -> doc ID -> posting
+	Words         map[string]string              `json:"words"`    // word -> term
+}
+
+// Save atomically writes the index to path.
+func (idx *InvertedIndex) Save(path string) error {
+	idx.mu.RLock()
+	f := indexFile{
+		FormatVersion: FormatVersion,
+		Analyzer:      idx.analyzer.Filters(),
+		Postings:      make(map[string]map[string]*Posting, len(idx.Index)),
+		Words:         make(map[string]string, len(idx.words)),
+	}
+	for term, postings := range idx.Index {
+		cp := make(map[string]*Posting, len(postings))
+		for id, p := range postings {
+			v := *p
+			cp[id] = &v
+		}
+		f.Postings[term] = cp
+	}
+	for word, term := range idx.words {
+		if len(idx.Index[term]) > 0 {
+			f.Words[word] = term
+		}
+	}
+	idx.mu.RUnlock()
+
+	return internal.WriteFileAtomic(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(&f)
+	})
+}
+
+// LoadInvertedIndex reads an index of the documents in store written by
+// Save, which recorded the analyzer it was built with. The index is
+// brought in line with the store, which may have been saved at another
+// moment: postings of documents the store does not hold are dropped, and
+// documents without postings are indexed. A missing file, or one in
+// another format, yields an index of every document in the store built
+// with a.
+func LoadInvertedIndex(path string, a *Analyzer, store DocumentStore) (*InvertedIndex, error) {
+	idx := NewInvertedIndex(store)
+	idx.analyzer = a
+	data, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		idx.rebuild()
+		return idx, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	var f indexFile
+	if err := json.NewDecoder(data).Decode(&f); err != nil {
+		return nil, fmt.Errorf("decode index %s: %w", path, err)
+	}
+	if f.FormatVersion != FormatVersion {
+		idx.rebuild()
+		return idx, nil
+	}
+	if idx.analyzer, err = newAnalyzer(f.Analyzer); err != nil {
+		return nil, fmt.Errorf("index %s: %w", path, err)
+	}
+	for word, term := range f.Words {
+		idx.addWord(word, term)
+	}
+	for term, docs := range f.Postings {
+		idx.Index[term] = docs
+		for id, p := range docs {
+			lengths := idx.docLen[id]
+			for f, pos := range p.Pos {
+				lengths[f] += len(pos)
+				idx.totalLen[f] += len(pos)
+			}
+			idx.docLen[id] = lengths
+			idx.docTerms[id] = append(idx.docTerms[id], term)
+		}
+	}
+	for id := range idx.docLen {
+		if _, ok := store.Get(id); !ok {
+			idx.removeDocument(id)
+		}
+	}
+	for _, d := range store.All() {
+		if _, ok := idx.docLen[d.ID]; !ok {
+			idx.addPostings(d.ID, FieldsOf(d))
+		}
+	}
+	return idx, nil
+}
+
+// rebuild recomputes all postings from the documents in the store.
+func (idx *InvertedIndex) rebuild() {
+	idx.Index = make(map[string]map[string]*Posting)
+	idx.words = make(map[string]string)
+	idx.termWords = make(map[string][]string)
+	idx.wordList.invalidate()
+	idx.docTerms = make(map[string][]string)
+	idx.docLen = make(map[string][numFields]int)
+	idx.totalLen = [numFields]int{}
+	for _, d := range idx.store.All() {
+		idx.addPostings(d.ID, FieldsOf(d))
+	}
+}
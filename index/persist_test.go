@@ -0,0 +1,64 @@
+package index
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/deepersensor/documcp/docstore"
+)
+
+func TestSaveLoad(t *testing.T) {
+	idx := newTestIndex("the connection pool", "worker queues")
+	store := idx.store.(*docstore.Store)
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := idx.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadInvertedIndex(path, idx.Analyzer(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{"pool", "queue", "connection pool", "poo*"} {
+		want, got := searchIDs(t, idx, q), searchIDs(t, loaded, q)
+		if len(got) != len(want) || len(got) > 0 && got[0] != want[0] {
+			t.Errorf("Search(%q) after loading = %v, want %v", q, got, want)
+		}
+	}
+}
+
+// TestLoadReconcilesWithStore checks that an index saved at another moment
+// than its store, as after a crash between the two writes, is brought in
+// line with the store when loaded.
+func TestLoadReconcilesWithStore(t *testing.T) {
+	idx := newTestIndex("the connection pool", "worker queues")
+	store := idx.store.(*docstore.Store)
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := idx.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	store.Delete("doc1")
+	store.Put(docstore.NewDocument("c", "http://example.com/c", "", "a pool of workers", nil, nil, nil, 1))
+
+	loaded, err := LoadInvertedIndex(path, idx.Analyzer(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := searchIDs(t, loaded, "pool"); len(got) != 1 || got[0] != "c" {
+		t.Errorf("Search(pool) = %v, want [c]", got)
+	}
+	if got := searchIDs(t, loaded, "connection"); len(got) != 0 {
+		t.Errorf("Search(connection) = %v, want nothing", got)
+	}
+}
+
+func TestLoadMissingIndexesStore(t *testing.T) {
+	idx := newTestIndex("the connection pool")
+	store := idx.store.(*docstore.Store)
+	loaded, err := LoadInvertedIndex(filepath.Join(t.TempDir(), "index.json"), idx.Analyzer(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := searchIDs(t, loaded, "pool"); len(got) != 1 {
+		t.Errorf("Search(pool) = %v, want [doc1]", got)
+	}
+}
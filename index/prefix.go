@@ -0,0 +1,204 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// maxPrefixExpansions caps the terms a prefix query expands to; the most
+// frequent are kept.
+const maxPrefixExpansions = 50
+
+// wordList is the dictionary of indexed words that prefix lookups
+// binary-search, sorted by their normalized forms. It is rebuilt on first
+// use after words are added, under its own lock since lookups run while
+// the index is only read-locked.
+type wordList struct {
+	mu    sync.Mutex
+	keys  []string // normalized words, sorted
+	words []string // the indexed word of each key
+	valid bool
+}
+
+// invalidate marks the list stale. idx.mu must be write-locked.
+func (l *wordList) invalidate() {
+	l.valid = false
+}
+
+// wordsWithPrefix returns the indexed words starting with prefix once both
+// are lower-cased and folded as the analyzer does, in lexical order of
+// those forms. The returned slice must not be modified. idx.mu must be
+// held.
+func (idx *InvertedIndex) wordsWithPrefix(prefix string) []string {
+	l := &idx.wordList
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.valid {
+		type entry struct{ key, word string }
+		entries := make([]entry, 0, len(idx.words))
+		for w := range idx.words {
+			entries = append(entries, entry{idx.analyzer.normalize(w), w})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].key != entries[j].key {
+				return entries[i].key < entries[j].key
+			}
+			return entries[i].word < entries[j].word
+		})
+		l.keys, l.words = make([]string, len(entries)), make([]string, len(entries))
+		for i, e := range entries {
+			l.keys[i], l.words[i] = e.key, e.word
+		}
+		l.valid = true
+	}
+	prefix = idx.analyzer.normalize(prefix)
+	i := sort.SearchStrings(l.keys, prefix)
+	j := i
+	for j < len(l.keys) && strings.HasPrefix(l.keys[j], prefix) {
+		j++
+	}
+	return l.words[i:j]
+}
+
+// prefixMatch is an indexed word starting with a prefix.
+type prefixMatch struct {
+	word string // the shortest indexed word for the term
+	term string
+	df   int // documents containing the term
+}
+
+// prefixTerms returns the terms of the indexed words starting with prefix,
+// most frequent first, at most limit of them. Words are matched as written
+// rather than as terms, so "configurat*" finds "configuration" although it
+// is indexed as "configur". idx.mu must be held.
+func (idx *InvertedIndex) prefixTerms(prefix string, limit int) []prefixMatch {
+	best := make(map[string]prefixMatch)
+	for _, w := range idx.wordsWithPrefix(prefix) {
+		term := idx.words[w]
+		postings := idx.Index[term]
+		if len(postings) == 0 {
+			continue
+		}
+		if m, seen := best[term]; seen && (len(m.word) < len(w) || len(m.word) == len(w) && m.word < w) {
+			continue
+		}
+		best[term] = prefixMatch{word: w, term: term, df: len(postings)}
+	}
+	matches := make([]prefixMatch, 0, len(best))
+	for _, m := range best {
+		matches = append(matches, m)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].df != matches[j].df {
+			return matches[i].df > matches[j].df
+		}
+		return matches[i].word < matches[j].word
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// expandPrefixes returns c with every prefix replaced by the terms it
+// expands to, including under NOT. idx.mu must be held.
+func (idx *InvertedIndex) expandPrefixes(c clause) clause {
+	switch c := c.(type) {
+	case prefixClause:
+		return idx.expandPrefix(c)
+	case nearClause:
+		if p, ok := c.left.(prefixClause); ok {
+			c.left = idx.expandPrefix(p)
+		}
+		if p, ok := c.right.(prefixClause); ok {
+			c.right = idx.expandPrefix(p)
+		}
+		return c
+	case andClause:
+		out := andClause{
+			required: make([]clause, len(c.required)),
+			optional: make([]clause, len(c.optional)),
+		}
+		for i, r := range c.required {
+			out.required[i] = idx.expandPrefixes(r)
+		}
+		for i, o := range c.optional {
+			out.optional[i] = idx.expandPrefixes(o)
+		}
+		return out
+	case orClause:
+		out := make(orClause, len(c))
+		for i, o := range c {
+			out[i] = idx.expandPrefixes(o)
+		}
+		return out
+	case notClause:
+		return notClause{idx.expandPrefixes(c.clause)}
+	}
+	return c
+}
+
+// expandPrefix returns the terms a prefix clause matches.
+func (idx *InvertedIndex) expandPrefix(c prefixClause) anyTerm {
+	matches := idx.prefixTerms(c.prefix, maxPrefixExpansions)
+	ts := make(anyTerm, len(matches))
+	for i, m := range matches {
+		ts[i] = queryTerm{text: m.term, field: c.field}
+	}
+	return ts
+}
+
+// Complete returns up to limit indexed words completing the last word of
+// text, most frequent first, and up to limit pages whose titles contain the
+// words of text with the last one taken as a prefix, best match first.
+// Sections, which repeat their page's title, are left out. No words are
+// returned if text ends with a space, since its last word is then
+// complete.
+func (idx *InvertedIndex) Complete(text string, limit int) ([]string, []SearchResult) {
+	fields := strings.Fields(strings.ToLower(text))
+	if len(fields) == 0 || limit <= 0 {
+		return nil, nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var (
+		words []string
+		title andClause
+	)
+	typed := fields
+	if last := fields[len(fields)-1]; strings.TrimRightFunc(text, unicode.IsSpace) == text {
+		typed = fields[:len(fields)-1]
+		for _, m := range idx.prefixTerms(last, limit) {
+			words = append(words, m.word)
+		}
+		title.required = append(title.required, idx.expandPrefix(prefixClause{prefix: last, field: FieldTitle}))
+	}
+	for _, w := range typed {
+		for _, tok := range idx.analyzer.tokenizeQuery(w) {
+			title.required = append(title.required, queryTerm{text: tok.text, field: FieldTitle, surface: tok.surface})
+		}
+	}
+	if len(title.required) == 0 {
+		return words, nil
+	}
+	ids := idx.matchQuery(title)
+	terms := title.terms()
+	titles := make([]SearchResult, 0, len(ids))
+	for id := range ids {
+		if d, ok := idx.store.Get(id); ok && !d.IsSection() {
+			titles = append(titles, SearchResult{Document: d, Score: idx.score(id, terms)})
+		}
+	}
+	sort.Slice(titles, func(i, j int) bool {
+		if titles[i].Score != titles[j].Score {
+			return titles[i].Score > titles[j].Score
+		}
+		return titles[i].ID < titles[j].ID
+	})
+	if len(titles) > limit {
+		titles = titles[:limit]
+	}
+	return words, titles
+}
@@ -0,0 +1,124 @@
+package index
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/deepersensor/documcp/docstore"
+)
+
+func TestCompleteWords(t *testing.T) {
+	idx := newTestIndex(
+		"configure the connection pool",
+		"configuration reference and config files",
+		"config config config",
+	)
+	tests := []struct {
+		text  string
+		limit int
+		want  []string
+	}{
+		// configure and configuration stem to one term, offered once.
+		{"conf", 10, []string{"config", "configure"}},
+		{"conf", 1, []string{"config"}},
+		{"the conn", 10, []string{"connection"}},
+		{"conf ", 10, nil},
+		{"", 10, nil},
+		{"zzz", 10, nil},
+	}
+	for _, tt := range tests {
+		words, _ := idx.Complete(tt.text, tt.limit)
+		if !slices.Equal(words, tt.want) {
+			t.Errorf("Complete(%q, %d) words = %q, want %q", tt.text, tt.limit, words, tt.want)
+		}
+	}
+}
+
+func TestSearchPrefix(t *testing.T) {
+	idx := newTestIndex(
+		"configure the connection pool",
+		"configuration reference and config files",
+		"connect to the server",
+	)
+	tests := []struct {
+		query string
+		want  string // matching IDs, sorted
+	}{
+		{"conf*", "doc1 doc2"},
+		{"conn*", "doc1 doc3"},
+		{"title:conf*", ""},
+		{"conf* pool", "doc1"},
+		{"zzz*", ""},
+	}
+	for _, tt := range tests {
+		ids := searchIDs(t, idx, tt.query)
+		sort.Strings(ids)
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestPrefixFolding checks that prefixes are folded like indexed words, so
+// that they match with or without diacritics.
+func TestPrefixFolding(t *testing.T) {
+	idx := newTestIndex("Café menu", "Cafeteria hours", "Naïve Bayes classifier")
+	tests := []struct {
+		query string
+		want  string // matching IDs, sorted
+	}{
+		{"cafe*", "doc1 doc2"},
+		{"café*", "doc1 doc2"},
+		{"CAFÉ*", "doc1 doc2"},
+		{"naive*", "doc3"},
+		{"naï*", "doc3"},
+	}
+	for _, tt := range tests {
+		ids := searchIDs(t, idx, tt.query)
+		sort.Strings(ids)
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+	if words, _ := idx.Complete("cafe", 10); !slices.Equal(words, []string{"cafeteria", "café"}) {
+		t.Errorf("Complete(cafe) words = %q, want the words as indexed", words)
+	}
+
+	// Without the fold filter, indexed terms keep their diacritics and so
+	// do prefixes.
+	lowercase, err := NewAnalyzer("lowercase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.SetAnalyzer(lowercase)
+	if got := strings.Join(searchIDs(t, idx, "cafe*"), " "); got != "doc2" {
+		t.Errorf("Search(cafe*) without folding = %q, want doc2", got)
+	}
+}
+
+// TestCompleteTitlesSkipsSections checks that sections, which share their
+// page's title, neither appear among the titles nor take their places.
+func TestCompleteTitlesSkipsSections(t *testing.T) {
+	store := docstore.NewStore()
+	idx := NewInvertedIndex(store)
+	page := docstore.NewDocument("p2", "http://example.com/two", "Page Two", "Intro", nil, nil, nil, 1)
+	for _, id := range []string{"s1", "s2", "s3"} {
+		s := docstore.NewDocument(id, page.URL+"#"+id, page.Title, "Section text", nil, nil, nil, 1)
+		s.ParentID = page.ID
+		s.Path = []string{id}
+		page.Sections = append(page.Sections, id)
+		store.Put(s)
+		idx.Put(s)
+	}
+	store.Put(page)
+	idx.Put(page)
+
+	for _, limit := range []int{1, 2, 5} {
+		_, titles := idx.Complete("page t", limit)
+		if len(titles) != 1 || titles[0].ID != "p2" {
+			t.Errorf("Complete(%q, %d) titles = %v, want only page p2", "page t", limit, titles)
+		}
+	}
+}
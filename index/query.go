@@ -0,0 +1,260 @@
+package index
+
+import "sort"
+
+// postingFunc returns the posting of a term in the document being matched,
+// or nil if the term does not occur in it.
+type postingFunc func(term string) *Posting
+
+// clause is one condition of a parsed query.
+type clause interface {
+	// terms returns the terms the clause looks for; they are what a
+	// matching document is scored on.
+	terms() []queryTerm
+	// match reports whether a document satisfies the clause.
+	match(get postingFunc) bool
+}
+
+// spanClause is a clause that matches at known positions, so it can be an
+// operand of NEAR.
+type spanClause interface {
+	clause
+	spans(get postingFunc) []span
+}
+
+// span is a run of positions [start, end] within one field.
+type span struct {
+	field      Field
+	start, end int
+}
+
+// andClause matches documents that satisfy all required clauses. Optional
+// clauses only add to the score, unless there are no required clauses, in
+// which case at least one of them must match.
+type andClause struct {
+	required, optional []clause
+}
+
+func (c andClause) terms() []queryTerm {
+	var ts []queryTerm
+	for _, r := range c.required {
+		ts = append(ts, r.terms()...)
+	}
+	for _, o := range c.optional {
+		ts = append(ts, o.terms()...)
+	}
+	return ts
+}
+
+func (c andClause) match(get postingFunc) bool {
+	for _, r := range c.required {
+		if !r.match(get) {
+			return false
+		}
+	}
+	if len(c.required) > 0 {
+		return true
+	}
+	for _, o := range c.optional {
+		if o.match(get) {
+			return true
+		}
+	}
+	return false
+}
+
+// orClause matches documents that satisfy any of its clauses.
+type orClause []clause
+
+func (c orClause) terms() []queryTerm {
+	var ts []queryTerm
+	for _, o := range c {
+		ts = append(ts, o.terms()...)
+	}
+	return ts
+}
+
+func (c orClause) match(get postingFunc) bool {
+	for _, o := range c {
+		if o.match(get) {
+			return true
+		}
+	}
+	return false
+}
+
+// notClause matches documents that do not satisfy its clause. It contributes
+// no terms to the score.
+type notClause struct {
+	clause
+}
+
+func (c notClause) terms() []queryTerm { return nil }
+
+func (c notClause) match(get postingFunc) bool {
+	return !c.clause.match(get)
+}
+
+// queryTerm is a single search term, optionally restricted to one field.
+type queryTerm struct {
+	text  string
+	field Field // -1 matches any field
+	// The word as typed, lower-cased, and the edit distance from it to
+	// the indexed word this term came from when matched fuzzily.
+	surface string
+	fuzz    int
+}
+
+// matches reports whether the posting satisfies the term's field restriction.
+func (t queryTerm) matches(p *Posting) bool {
+	if t.field < 0 {
+		return true
+	}
+	return p.tf(t.field) > 0
+}
+
+func (t queryTerm) terms() []queryTerm { return []queryTerm{t} }
+
+func (t queryTerm) match(get postingFunc) bool {
+	p := get(t.text)
+	return p != nil && t.matches(p)
+}
+
+func (t queryTerm) spans(get postingFunc) []span {
+	p := get(t.text)
+	if p == nil {
+		return nil
+	}
+	var ss []span
+	for f := Field(0); f < numFields; f++ {
+		if t.field >= 0 && t.field != f {
+			continue
+		}
+		for _, pos := range p.Pos[f] {
+			ss = append(ss, span{f, pos, pos})
+		}
+	}
+	return ss
+}
+
+// prefixClause matches words starting with prefix, as typed. It matches
+// nothing until expandPrefixes replaces it by the terms it expands to.
+type prefixClause struct {
+	prefix string
+	field  Field // -1 matches any field
+}
+
+func (c prefixClause) terms() []queryTerm           { return nil }
+func (c prefixClause) match(get postingFunc) bool   { return false }
+func (c prefixClause) spans(get postingFunc) []span { return nil }
+
+// anyTerm matches documents containing any of its terms, such as the
+// expansions of a prefix.
+type anyTerm []queryTerm
+
+func (c anyTerm) terms() []queryTerm { return c }
+
+func (c anyTerm) match(get postingFunc) bool {
+	for _, t := range c {
+		if t.match(get) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c anyTerm) spans(get postingFunc) []span {
+	var ss []span
+	for _, t := range c {
+		ss = append(ss, t.spans(get)...)
+	}
+	return ss
+}
+
+// phraseClause matches words at fixed offsets from the first one, within
+// one field. Offsets are consecutive unless the analyzer dropped stop words
+// from the phrase.
+type phraseClause struct {
+	words    []string
+	surfaces []string
+	offsets  []int
+	field    Field // -1 matches any field
+}
+
+func (c phraseClause) terms() []queryTerm {
+	ts := make([]queryTerm, len(c.words))
+	for i, w := range c.words {
+		ts[i] = queryTerm{text: w, field: c.field}
+	}
+	return ts
+}
+
+func (c phraseClause) match(get postingFunc) bool {
+	return len(c.spans(get)) > 0
+}
+
+func (c phraseClause) spans(get postingFunc) []span {
+	postings := make([]*Posting, len(c.words))
+	for i, w := range c.words {
+		if postings[i] = get(w); postings[i] == nil {
+			return nil
+		}
+	}
+	var ss []span
+	for f := Field(0); f < numFields; f++ {
+		if c.field >= 0 && c.field != f {
+			continue
+		}
+	next:
+		for _, start := range postings[0].Pos[f] {
+			for i := 1; i < len(postings); i++ {
+				if !hasPosition(postings[i].Pos[f], start+c.offsets[i]) {
+					continue next
+				}
+			}
+			ss = append(ss, span{f, start, start + c.offsets[len(c.offsets)-1]})
+		}
+	}
+	return ss
+}
+
+// nearClause matches two operands that occur in the same field with at most
+// dist positions between the end of one and the start of the other, in
+// either order. Adjacent words are at distance 1.
+type nearClause struct {
+	left, right spanClause
+	dist        int
+}
+
+func (c nearClause) terms() []queryTerm {
+	return append(c.left.terms(), c.right.terms()...)
+}
+
+func (c nearClause) match(get postingFunc) bool {
+	left := c.left.spans(get)
+	if len(left) == 0 {
+		return false
+	}
+	right := c.right.spans(get)
+	for _, l := range left {
+		for _, r := range right {
+			if l.field != r.field || l == r {
+				continue
+			}
+			gap := r.start - l.end
+			if r.start < l.start {
+				gap = l.start - r.end
+			}
+			if gap <= c.dist {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasPosition reports whether the sorted positions include pos.
+func hasPosition(positions []int, pos int) bool {
+	i := sort.SearchInts(positions, pos)
+	return i < len(positions) && positions[i] == pos
+}
@@ -0,0 +1,81 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSearchPhraseAndNear(t *testing.T) {
+	idx := newTestIndex(
+		"The quick brown fox jumps over the lazy dog.",
+		"The fox is quick.",
+		"Call getUserById to fetch a user record.",
+		"Open the connection pool before the first query is sent to the database server.",
+	)
+	putFields(idx, "doc5", "http://example.com/guide", Fields{Title: "Quick fox guide", Body: "Nothing about animals here."})
+
+	tests := []struct {
+		query string
+		want  string // matching IDs, sorted
+	}{
+		{`"quick brown fox"`, "doc1"},
+		{`"brown quick"`, ""},
+		{`"quick fox"`, "doc5"},
+		{`title:"quick fox"`, "doc5"},
+		{`body:"quick fox"`, ""},
+		{`"fox jumps over the lazy dog"`, "doc1"},
+		{`"get user"`, "doc3"}, // identifier parts are adjacent
+		{`"user by id"`, "doc3"},
+		{`"getUserById"`, "doc3"},
+		{"quick NEAR/1 fox", "doc5"},
+		{"quick NEAR/2 fox", "doc1 doc2 doc5"},
+		{"fox NEAR/2 quick", "doc1 doc2 doc5"}, // either order
+		{"quick NEAR dog", "doc1"},
+		{"connection NEAR/3 query", ""},
+		{"connection NEAR/6 query", "doc4"},
+		{`"connection pool" NEAR/4 query`, "doc4"},
+		{`"connection pool" NEAR/3 query`, ""},
+		{"quick NEAR/2 fox NEAR/3 jumps", "doc1"},
+		{"title:quick NEAR/1 fox", "doc5"},
+	}
+	for _, tt := range tests {
+		ids := searchIDs(t, idx, tt.query)
+		sort.Strings(ids)
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestNearDistance(t *testing.T) {
+	get := func(positions map[string][]int) postingFunc {
+		return func(term string) *Posting {
+			pos, ok := positions[term]
+			if !ok {
+				return nil
+			}
+			p := &Posting{}
+			p.Pos[FieldBody] = pos
+			return p
+		}
+	}
+	tests := []struct {
+		left, right []int
+		dist        int
+		want        bool
+	}{
+		{[]int{0}, []int{1}, 1, true}, // adjacent
+		{[]int{0}, []int{2}, 1, false},
+		{[]int{5}, []int{2}, 3, true}, // right before left
+		{[]int{5}, []int{1}, 3, false},
+		{[]int{0, 20}, []int{9, 30}, 1, false},
+		{[]int{0, 20}, []int{9, 30}, 10, true},
+	}
+	for _, tt := range tests {
+		c := nearClause{left: queryTerm{text: "l", field: -1}, right: queryTerm{text: "r", field: -1}, dist: tt.dist}
+		if got := c.match(get(map[string][]int{"l": tt.left, "r": tt.right})); got != tt.want {
+			t.Errorf("%v NEAR/%d %v = %v, want %v", tt.left, tt.dist, tt.right, got, tt.want)
+		}
+	}
+}
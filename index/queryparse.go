@@ -0,0 +1,442 @@
+package index
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultNearDistance is the proximity used by NEAR without a /n suffix.
+const defaultNearDistance = 10
+
+// SyntaxError reports a query that cannot be parsed.
+type SyntaxError struct {
+	Query  string
+	Offset int // byte offset in Query at which the problem was found
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid query at column %d: %s", e.Column(), e.Msg)
+}
+
+// Column returns the 1-based column, in characters, of the problem.
+func (e *SyntaxError) Column() int {
+	return utf8.RuneCountInString(e.Query[:e.Offset]) + 1
+}
+
+// itemKind identifies a lexical item of the query language.
+type itemKind int
+
+const (
+	itemWord    itemKind = iota
+	itemPhrase           // "quoted words"
+	itemField            // field: prefix
+	itemLParen           // (
+	itemRParen           // )
+	itemAnd              // AND
+	itemOr               // OR
+	itemNot              // NOT
+	itemNear             // NEAR or NEAR/n
+	itemRequire          // + prefix
+	itemExclude          // - prefix
+)
+
+// item is a lexical item and its byte offset in the query.
+type item struct {
+	kind  itemKind
+	text  string
+	field Field // itemField
+	dist  int   // itemNear
+	off   int
+}
+
+func (it item) String() string {
+	switch it.kind {
+	case itemWord:
+		return strconv.Quote(it.text)
+	case itemPhrase:
+		return "phrase " + strconv.Quote(it.text)
+	case itemField:
+		return it.field.String() + ":"
+	case itemLParen:
+		return "("
+	case itemRParen:
+		return ")"
+	case itemRequire:
+		return "+"
+	case itemExclude:
+		return "-"
+	}
+	return it.text
+}
+
+// parseQuery parses a query. Its grammar, loosest binding first:
+//
+//	a OR b       either matches
+//	a AND b, a b both match; AND may be omitted
+//	+a           a is required; when a group has required terms, its
+//	             unmarked terms are optional and only affect the score
+//	NOT a, -a    a does not match
+//	(a b)        grouping
+//	field:a      a, which may be a group, only matches in field (title,
+//	             heading, body or code); unknown names are ordinary text
+//	a NEAR/n b   words or phrases a and b occur within n positions of
+//	             each other; NEAR alone means NEAR/10
+//	"a b"        phrase: the words are adjacent and in order
+//	conf*        any word starting with conf
+//
+// Operators must be written in upper case. A word that splits into several
+// terms, such as os.path.join or a run of CJK characters, is a phrase. An
+// empty query parses to a nil clause.
+func parseQuery(s string, a *Analyzer) (clause, error) {
+	items, err := lexQuery(s)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	p := &queryParser{query: s, items: items, analyzer: a}
+	c, err := p.parseOr(-1)
+	if err != nil {
+		return nil, err
+	}
+	if it, ok := p.peek(); ok {
+		return nil, p.errorAt(it.off, "unexpected "+it.String())
+	}
+	return c, nil
+}
+
+// lexQuery splits a query into items.
+func lexQuery(s string) ([]item, error) {
+	var (
+		items []item
+		depth int
+	)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(':
+			items = append(items, item{kind: itemLParen, text: "(", off: i})
+			depth++
+			i++
+		case r == ')':
+			items = append(items, item{kind: itemRParen, text: ")", off: i})
+			depth--
+			i++
+		case r == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, &SyntaxError{Query: s, Offset: i, Msg: "unterminated quote"}
+			}
+			items = append(items, item{kind: itemPhrase, text: s[i+1 : i+1+end], off: i})
+			i += end + 2
+		case (r == '+' || r == '-') && i+1 < len(s) && startsOperand(s[i+1:]):
+			kind := itemRequire
+			if r == '-' {
+				kind = itemExclude
+			}
+			items = append(items, item{kind: kind, text: string(r), off: i})
+			i++
+		default:
+			if f, n, ok := fieldPrefix(s[i:]); ok {
+				items = append(items, item{kind: itemField, field: f, text: s[i : i+n], off: i})
+				i += n
+				continue
+			}
+			end := strings.IndexFunc(s[i:], func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+			if end < 0 {
+				end = len(s) - i
+			}
+			word := s[i : i+end]
+			// Closing parentheses end a word only inside a group, so that
+			// code such as print() can be searched for.
+			closers := 0
+			for depth > 0 && len(word) > 1 && strings.HasSuffix(word, ")") {
+				word = word[:len(word)-1]
+				closers++
+				depth--
+			}
+			it, err := wordItem(s, word, i)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, it)
+			for j := 0; j < closers; j++ {
+				items = append(items, item{kind: itemRParen, text: ")", off: i + len(word) + j})
+			}
+			i += end
+		}
+	}
+	return items, nil
+}
+
+// startsOperand reports whether a + or - prefix is attached to what follows.
+func startsOperand(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return !unicode.IsSpace(r) && r != ')' && r != '+' && r != '-'
+}
+
+// fieldPrefix recognises a known field name followed by a colon.
+func fieldPrefix(s string) (Field, int, bool) {
+	name, _, ok := strings.Cut(s, ":")
+	if !ok || name == "" || strings.IndexFunc(name, func(r rune) bool { return !unicode.IsLetter(r) }) >= 0 {
+		return 0, 0, false
+	}
+	f, known := ParseField(name)
+	return f, len(name) + 1, known
+}
+
+// wordItem classifies a bare word as an operator or a search word.
+func wordItem(query, word string, off int) (item, error) {
+	it := item{kind: itemWord, text: word, off: off}
+	switch word {
+	case "AND":
+		it.kind = itemAnd
+	case "OR":
+		it.kind = itemOr
+	case "NOT":
+		it.kind = itemNot
+	case "NEAR":
+		it.kind, it.dist = itemNear, defaultNearDistance
+	default:
+		rest, ok := strings.CutPrefix(word, "NEAR/")
+		if !ok {
+			break
+		}
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 1 {
+			return it, &SyntaxError{Query: query, Offset: off, Msg: fmt.Sprintf("invalid NEAR distance %q", rest)}
+		}
+		it.kind, it.dist = itemNear, n
+	}
+	return it, nil
+}
+
+// isPrefix reports whether a word ends in * and so matches every word
+// starting with the rest of it.
+func isPrefix(word string) bool {
+	return len(strings.TrimRight(word, "*")) > 0 && strings.HasSuffix(word, "*")
+}
+
+// queryParser is a recursive descent parser over lexed items.
+type queryParser struct {
+	query    string
+	items    []item
+	pos      int
+	analyzer *Analyzer
+}
+
+func (p *queryParser) peek() (item, bool) {
+	if p.pos >= len(p.items) {
+		return item{}, false
+	}
+	return p.items[p.pos], true
+}
+
+func (p *queryParser) next() (item, bool) {
+	it, ok := p.peek()
+	if ok {
+		p.pos++
+	}
+	return it, ok
+}
+
+// accept consumes the next item if it has one of the given kinds.
+func (p *queryParser) accept(kinds ...itemKind) (item, bool) {
+	if it, ok := p.peek(); ok {
+		for _, k := range kinds {
+			if it.kind == k {
+				p.pos++
+				return it, true
+			}
+		}
+	}
+	return item{}, false
+}
+
+// atOperand reports whether the next item can start an operand.
+func (p *queryParser) atOperand() bool {
+	it, ok := p.peek()
+	if !ok {
+		return false
+	}
+	switch it.kind {
+	case itemWord, itemPhrase, itemField, itemLParen, itemNot, itemRequire, itemExclude:
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) errorAt(off int, msg string) error {
+	return &SyntaxError{Query: p.query, Offset: off, Msg: msg}
+}
+
+// expected reports that an operand was expected at the current item.
+func (p *queryParser) expected() error {
+	it, ok := p.peek()
+	if !ok {
+		return p.errorAt(len(p.query), "query ends where a term was expected")
+	}
+	return p.errorAt(it.off, "unexpected "+it.String())
+}
+
+func (p *queryParser) parseOr(field Field) (clause, error) {
+	var alts []clause
+	for {
+		if !p.atOperand() {
+			return nil, p.expected()
+		}
+		c, err := p.parseAnd(field)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			alts = append(alts, c)
+		}
+		if _, ok := p.accept(itemOr); !ok {
+			break
+		}
+	}
+	switch len(alts) {
+	case 0:
+		return nil, nil
+	case 1:
+		return alts[0], nil
+	}
+	return orClause(alts), nil
+}
+
+func (p *queryParser) parseAnd(field Field) (clause, error) {
+	var plain, required, excluded []clause
+	for n := 0; ; n++ {
+		if and, ok := p.accept(itemAnd); ok {
+			if n == 0 {
+				return nil, p.errorAt(and.off, "unexpected AND")
+			}
+			if !p.atOperand() {
+				return nil, p.expected()
+			}
+		} else if !p.atOperand() {
+			break
+		}
+		mod, _ := p.accept(itemNot, itemExclude, itemRequire)
+		c, err := p.parsePrimary(field)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			continue
+		}
+		switch mod.kind {
+		case itemNot, itemExclude:
+			excluded = append(excluded, notClause{c})
+		case itemRequire:
+			required = append(required, c)
+		default:
+			plain = append(plain, c)
+		}
+	}
+	if len(required) > 0 {
+		return andClause{required: append(required, excluded...), optional: plain}, nil
+	}
+	if len(plain) == 1 && len(excluded) == 0 {
+		return plain[0], nil
+	}
+	if len(plain)+len(excluded) == 0 {
+		return nil, nil
+	}
+	return andClause{required: append(plain, excluded...)}, nil
+}
+
+func (p *queryParser) parsePrimary(field Field) (clause, error) {
+	it, ok := p.next()
+	if !ok {
+		return nil, p.expected()
+	}
+	switch it.kind {
+	case itemField:
+		if !p.atOperand() {
+			return nil, p.errorAt(it.off, it.String()+" must be followed by a term")
+		}
+		return p.parsePrimary(it.field)
+	case itemLParen:
+		c, err := p.parseOr(field)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(itemRParen); !ok {
+			return nil, p.errorAt(it.off, "missing closing parenthesis")
+		}
+		return c, nil
+	case itemWord, itemPhrase:
+		return p.parseNear(p.leaf(it, field), field)
+	}
+	p.pos--
+	return nil, p.expected()
+}
+
+// parseNear parses any NEAR operators following the word or phrase left.
+// a NEAR b NEAR c is read as a NEAR b AND b NEAR c.
+func (p *queryParser) parseNear(left spanClause, field Field) (clause, error) {
+	var nears []clause
+	for {
+		op, ok := p.accept(itemNear)
+		if !ok {
+			break
+		}
+		f := field
+		if fp, ok := p.accept(itemField); ok {
+			f = fp.field
+		}
+		it, ok := p.accept(itemWord, itemPhrase)
+		if !ok {
+			return nil, p.errorAt(op.off, "NEAR must be followed by a word or phrase")
+		}
+		right := p.leaf(it, f)
+		if left == nil || right == nil {
+			return nil, p.errorAt(op.off, "NEAR must be between two words or phrases")
+		}
+		nears = append(nears, nearClause{left: left, right: right, dist: op.dist})
+		left = right
+	}
+	switch len(nears) {
+	case 0:
+		if left == nil {
+			return nil, nil
+		}
+		return left, nil
+	case 1:
+		return nears[0], nil
+	}
+	return andClause{required: nears}, nil
+}
+
+// leaf returns the term, phrase or prefix for a word or quoted item, or nil
+// if it contains no terms, e.g. only stop words.
+func (p *queryParser) leaf(it item, field Field) spanClause {
+	if it.kind == itemWord && isPrefix(it.text) {
+		return prefixClause{prefix: strings.ToLower(strings.TrimRight(it.text, "*")), field: field}
+	}
+	if it.kind == itemWord {
+		if ts := p.analyzer.tokenizeQuery(it.text); len(ts) == 1 {
+			return queryTerm{text: ts[0].text, field: field, surface: ts[0].surface}
+		}
+	}
+	tokens := p.analyzer.tokenizePhrase(it.text)
+	switch len(tokens) {
+	case 0:
+		return nil
+	case 1:
+		return queryTerm{text: tokens[0].text, field: field, surface: tokens[0].surface}
+	}
+	c := phraseClause{field: field}
+	for _, t := range tokens {
+		c.words = append(c.words, t.text)
+		c.surfaces = append(c.surfaces, t.surface)
+		c.offsets = append(c.offsets, t.pos-tokens[0].pos)
+	}
+	return c
+}
@@ -0,0 +1,184 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// describe renders a parsed query compactly: +required, optional and -excluded
+// clauses of a conjunction in parentheses, field:term restrictions,
+// "phrases", prefix* words and NEAR/n.
+func describe(c clause) string {
+	fieldPrefix := func(f Field) string {
+		if f < 0 {
+			return ""
+		}
+		return f.String() + ":"
+	}
+	switch c := c.(type) {
+	case nil:
+		return "<nil>"
+	case queryTerm:
+		return fieldPrefix(c.field) + c.text
+	case prefixClause:
+		return fieldPrefix(c.field) + c.prefix + "*"
+	case phraseClause:
+		return fieldPrefix(c.field) + `"` + strings.Join(c.words, " ") + `"`
+	case nearClause:
+		return fmt.Sprintf("(%s NEAR/%d %s)", describe(c.left), c.dist, describe(c.right))
+	case notClause:
+		return "-" + describe(c.clause)
+	case orClause:
+		parts := make([]string, len(c))
+		for i, alt := range c {
+			parts[i] = describe(alt)
+		}
+		return "(" + strings.Join(parts, " OR ") + ")"
+	case andClause:
+		var parts []string
+		for _, r := range c.required {
+			if _, ok := r.(notClause); ok {
+				parts = append(parts, describe(r))
+			} else {
+				parts = append(parts, "+"+describe(r))
+			}
+		}
+		for _, o := range c.optional {
+			parts = append(parts, describe(o))
+		}
+		return "(" + strings.Join(parts, " ") + ")"
+	}
+	return fmt.Sprintf("%T", c)
+}
+
+func TestParseQuery(t *testing.T) {
+	standard, err := NewAnalyzer("standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	english, err := NewAnalyzer("english")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query    string
+		analyzer *Analyzer
+		want     string
+	}{
+		{"", standard, "<nil>"},
+		{"red", standard, "red"},
+		{"Red car", standard, "(+red +car)"},
+		{"red AND car", standard, "(+red +car)"},
+		{"red OR blue", standard, "(red OR blue)"},
+		{"red OR blue car", standard, "(red OR (+blue +car))"},
+		{"(red OR blue) car", standard, "(+(red OR blue) +car)"},
+		{"+red car", standard, "(+red car)"},
+		{"red -car", standard, "(+red -car)"},
+		{"red NOT car", standard, "(+red -car)"},
+		{"title:red car", standard, "(+title:red +car)"},
+		{"title:(red OR car)", standard, "(title:red OR title:car)"},
+		{"headings:red", standard, "heading:red"},
+		{"nofield:red", standard, `"nofield red"`},
+		{`"red car"`, standard, `"red car"`},
+		{"red NEAR car", standard, "(red NEAR/10 car)"},
+		{"red NEAR/3 car NEAR bus", standard, "(+(red NEAR/3 car) +(car NEAR/10 bus))"},
+		{`"red car" NEAR/2 title:bus`, standard, `("red car" NEAR/2 title:bus)`},
+		{"conf*", standard, "conf*"},
+		{"os.path.join", standard, `"os path join"`},
+		{"getUserById", standard, "getuserbyid"},
+		{"print()", standard, "print"},
+		{"(print())", standard, "print"},
+		{"red or blue", standard, "(+red +or +blue)"}, // operators are upper case
+		{"the running tasks", english, "(+run +task)"},
+		{"the OR a", english, "<nil>"},
+		{`"cancel the task"`, english, `"cancel task"`},
+	}
+	for _, tt := range tests {
+		c, err := parseQuery(tt.query, tt.analyzer)
+		if err != nil {
+			t.Errorf("parseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if got := describe(c); got != tt.want {
+			t.Errorf("parseQuery(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	a, err := NewAnalyzer("standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query  string
+		offset int
+		msg    string
+	}{
+		{`"open`, 0, "unterminated quote"},
+		{`red "open`, 4, "unterminated quote"},
+		{"red AND", 7, "query ends where a term was expected"},
+		{"AND red", 0, "unexpected AND"},
+		{"red OR", 6, "query ends where a term was expected"},
+		{"(red car", 0, "missing closing parenthesis"},
+		{"red )", 4, "unexpected )"},
+		{"red NEAR/x car", 4, `invalid NEAR distance "x"`},
+		{"red NEAR/0 car", 4, `invalid NEAR distance "0"`},
+		{"red NEAR (car)", 4, "NEAR must be followed by a word or phrase"},
+		{"title:", 0, "title: must be followed by a term"},
+	}
+	for _, tt := range tests {
+		_, err := parseQuery(tt.query, a)
+		var serr *SyntaxError
+		if !errors.As(err, &serr) {
+			t.Errorf("parseQuery(%q) error = %v, want a SyntaxError", tt.query, err)
+			continue
+		}
+		if serr.Offset != tt.offset || serr.Msg != tt.msg {
+			t.Errorf("parseQuery(%q) error at %d %q, want at %d %q", tt.query, serr.Offset, serr.Msg, tt.offset, tt.msg)
+		}
+	}
+}
+
+func TestSyntaxErrorColumn(t *testing.T) {
+	err := &SyntaxError{Query: `café "open`, Offset: 6}
+	if got := err.Column(); got != 6 {
+		t.Errorf("Column() = %d, want 6", got)
+	}
+}
+
+func TestSearchBoolean(t *testing.T) {
+	idx := newTestIndex(
+		"red car with a fast engine",
+		"blue car",
+		"red bus",
+		"green bicycle",
+	)
+	tests := []struct {
+		query string
+		want  string // matching IDs, sorted
+	}{
+		{"red", "doc1 doc3"},
+		{"red car", "doc1"},
+		{"red AND car", "doc1"},
+		{"red OR blue", "doc1 doc2 doc3"},
+		{"car -red", "doc2"},
+		{"car NOT blue", "doc1"},
+		{"(red OR green) -bus", "doc1 doc4"},
+		{"+car red", "doc1 doc2"},
+		{"+car +red", "doc1"},
+		{"bi*", "doc4"},
+		{"red -(car OR bus)", ""},
+		{"violet", ""},
+	}
+	for _, tt := range tests {
+		ids := searchIDs(t, idx, tt.query)
+		sort.Strings(ids)
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
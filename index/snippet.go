@@ -0,0 +1,217 @@
+package index
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Snippet defaults.
+const (
+	DefaultSnippetLength = 200
+	DefaultHighlightPre  = "**"
+	DefaultHighlightPost = "**"
+)
+
+// SnippetOptions controls how passages are cut and marked.
+type SnippetOptions struct {
+	Length    int    // approximate maximum length in bytes, markers excluded
+	Pre, Post string // inserted before and after each matched word
+}
+
+// Highlighter cuts the passages of texts that best match one query.
+type Highlighter struct {
+	analyzer *Analyzer
+	weights  map[string]float64 // term -> idf
+	opts     SnippetOptions
+}
+
+// Highlighter returns a highlighter for the query. Words matched by the
+// query, including prefix and fuzzy matches, are highlighted; excluded
+// words are not. A malformed query highlights nothing. A zero Length in
+// opts means DefaultSnippetLength.
+func (idx *InvertedIndex) Highlighter(queryStr string, opts SnippetOptions) *Highlighter {
+	if opts.Length <= 0 {
+		opts.Length = DefaultSnippetLength
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	h := &Highlighter{analyzer: idx.analyzer, weights: make(map[string]float64), opts: opts}
+	q, err := idx.parse(queryStr)
+	if err != nil || q == nil {
+		return h
+	}
+	if fq, ok := idx.expandFuzzy(q); ok {
+		q = fq
+	}
+	n := float64(len(idx.docLen))
+	for _, t := range q.terms() {
+		df := float64(len(idx.Index[t.text]))
+		h.weights[t.text] = math.Log(1 + (n-df+0.5)/(df+0.5))
+	}
+	return h
+}
+
+// highlight is the byte range of a matched word in the text.
+type highlight struct {
+	start, end int
+	term       string
+}
+
+// Snippet returns the passage of text containing the most, and rarest,
+// query terms, with matched words wrapped in the highlight markers. Runs of
+// whitespace are collapsed, and "…" marks text cut off at either end. If
+// nothing matches, the passage is the start of the text.
+func (h *Highlighter) Snippet(text string) string {
+	var hs []highlight
+	if len(h.weights) > 0 {
+		for _, tok := range h.analyzer.tokenize(text) {
+			if _, ok := h.weights[tok.text]; ok {
+				hs = append(hs, highlight{tok.start, tok.end, tok.text})
+			}
+		}
+	}
+	sort.Slice(hs, func(i, j int) bool {
+		if hs[i].start != hs[j].start {
+			return hs[i].start < hs[j].start
+		}
+		return hs[i].end > hs[j].end
+	})
+	budget := h.opts.Length
+	first, last := h.bestWindow(hs, budget)
+
+	// Center the matches in the passage and cut it at word boundaries.
+	start, end := 0, min(len(text), budget)
+	if first < last {
+		ms, me := hs[first].start, hs[first].end
+		for _, hl := range hs[first:last] {
+			me = max(me, hl.end)
+		}
+		start = max(0, ms-(budget-(me-ms))/2)
+		end = min(len(text), start+budget)
+		start = max(0, min(start, end-budget))
+		start = wordStart(text, start, ms)
+		end = wordEnd(text, end, me)
+		hs = hs[first:last]
+	} else {
+		end = wordEnd(text, end, 0)
+		hs = nil
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("… ")
+	}
+	pos := start
+	for _, r := range mergeHighlights(hs) {
+		writeCollapsed(&b, text[pos:r.start])
+		b.WriteString(h.opts.Pre)
+		b.WriteString(text[r.start:r.end])
+		b.WriteString(h.opts.Post)
+		pos = r.end
+	}
+	writeCollapsed(&b, text[pos:end])
+	out := strings.TrimSpace(b.String())
+	if end < len(text) && out != "" {
+		out += " …"
+	}
+	return out
+}
+
+// mergeHighlights joins highlights, sorted by start, that overlap or touch,
+// such as the parts of an identifier and the identifier itself, so each
+// run of matched text is marked once.
+func mergeHighlights(hs []highlight) []highlight {
+	var out []highlight
+	for _, hl := range hs {
+		if n := len(out); n > 0 && hl.start <= out[n-1].end {
+			out[n-1].end = max(out[n-1].end, hl.end)
+			continue
+		}
+		out = append(out, hl)
+	}
+	return out
+}
+
+// bestWindow returns the range hs[first:last] of highlights fitting in a
+// passage of budget bytes that has the highest total weight of distinct
+// terms, with more matches breaking ties.
+func (h *Highlighter) bestWindow(hs []highlight, budget int) (first, last int) {
+	var (
+		counts    = make(map[string]int)
+		weight    float64
+		bestScore = -1.0
+		j         int
+	)
+	for i := range hs {
+		for j < len(hs) && hs[j].end-hs[i].start <= budget {
+			if counts[hs[j].term]++; counts[hs[j].term] == 1 {
+				weight += h.weights[hs[j].term]
+			}
+			j++
+		}
+		if score := weight + 0.01*float64(j-i); j > i && score > bestScore {
+			bestScore, first, last = score, i, j
+		}
+		if j > i {
+			if counts[hs[i].term]--; counts[hs[i].term] == 0 {
+				weight -= h.weights[hs[i].term]
+			}
+		} else {
+			j = i + 1 // a single word longer than the budget
+		}
+	}
+	return first, last
+}
+
+// wordStart moves start forward to the beginning of a word, or to limit,
+// the start of the first match, if there is none before it.
+func wordStart(text string, start, limit int) int {
+	if start == 0 {
+		return 0
+	}
+	for i := start; i < limit; i++ {
+		if r, _ := utf8.DecodeLastRuneInString(text[:i]); unicode.IsSpace(r) {
+			return i
+		}
+	}
+	return limit
+}
+
+// wordEnd moves end back to the end of a word, without passing limit. Text
+// without spaces, such as Japanese, is cut at a character boundary instead.
+func wordEnd(text string, end, limit int) int {
+	if end == len(text) {
+		return end
+	}
+	for i := end; i > limit; i-- {
+		if r, _ := utf8.DecodeRuneInString(text[i:]); unicode.IsSpace(r) {
+			return i
+		}
+	}
+	for end > limit && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return max(end, limit)
+}
+
+// writeCollapsed writes s with each run of whitespace replaced by a space.
+func writeCollapsed(b *strings.Builder, s string) {
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	if space && b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+}
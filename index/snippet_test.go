@@ -0,0 +1,64 @@
+package index
+
+import "testing"
+
+func TestSnippetHighlights(t *testing.T) {
+	idx := newTestIndex(
+		"Call cancelTask(id) to stop a task.",
+		"Tasks are queued and run by workers.",
+	)
+	tests := []struct {
+		query, text, want string
+	}{
+		{"stop", "Call cancelTask(id) to stop a task.", "Call cancelTask(id) to **stop** a task."},
+		{"cancel", "Call cancelTask(id) to stop a task.", "Call **cancel**Task(id) to stop a task."},
+		{"cancel task", "Call cancelTask(id) to stop a task.", "Call **cancelTask**(id) to stop a **task**."},
+		{"canceltask", "Call cancelTask(id) to stop a task.", "Call **cancelTask**(id) to stop a task."},
+		{"nothing", "Call cancelTask(id) to stop a task.", "Call cancelTask(id) to stop a task."},
+		{"queued workers", "Tasks  are\nqueued and run by workers.", "Tasks are **queued** and run by **workers**."},
+	}
+	for _, tt := range tests {
+		got := idx.Highlighter(tt.query, SnippetOptions{Pre: "**", Post: "**"}).Snippet(tt.text)
+		if got != tt.want {
+			t.Errorf("Snippet(%q) for %q = %q, want %q", tt.text, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSnippetWindow(t *testing.T) {
+	text := "Intro words that do not matter here. " +
+		"More filler text follows before the match. " +
+		"The connection pool is configured here. " +
+		"Trailing text that is not needed at all."
+	idx := newTestIndex(text)
+	got := idx.Highlighter("pool", SnippetOptions{Length: 40, Pre: "[", Post: "]"}).Snippet(text)
+	want := "… The connection [pool] is configured …"
+	if got != want {
+		t.Errorf("Snippet = %q, want %q", got, want)
+	}
+}
+
+func TestMergeHighlights(t *testing.T) {
+	tests := []struct {
+		in, want []highlight
+	}{
+		{nil, nil},
+		{[]highlight{{0, 4, "a"}}, []highlight{{0, 4, "a"}}},
+		{[]highlight{{0, 10, "ab"}, {0, 4, "a"}, {4, 10, "b"}}, []highlight{{0, 10, "ab"}}},
+		{[]highlight{{0, 4, "a"}, {4, 10, "b"}}, []highlight{{0, 10, "a"}}},
+		{[]highlight{{0, 4, "a"}, {5, 10, "b"}}, []highlight{{0, 4, "a"}, {5, 10, "b"}}},
+	}
+	for _, tt := range tests {
+		got := mergeHighlights(tt.in)
+		if len(got) != len(tt.want) {
+			t.Errorf("mergeHighlights(%v) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].start != tt.want[i].start || got[i].end != tt.want[i].end {
+				t.Errorf("mergeHighlights(%v) = %v, want %v", tt.in, got, tt.want)
+				break
+			}
+		}
+	}
+}
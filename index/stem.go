@@ -0,0 +1,270 @@
+package index
+
+// stem reduces an English word to its stem with the Porter algorithm, so
+// that "configure", "configuring" and "configuration" all become
+// "configur". Words that are not lower-case ASCII letters, such as code
+// identifiers with digits or non-Latin words, are returned unchanged.
+func stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	s := &porter{b: []byte(word), k: len(word) - 1}
+	s.step1ab()
+	if s.k > 0 {
+		s.step1c()
+		s.step2()
+		s.step3()
+		s.step4()
+		s.step5()
+	}
+	return string(s.b[:s.k+1])
+}
+
+// porter holds the word being stemmed: b[0..k] is the current word and j
+// marks the end of the stem left when a suffix matched by ends is removed.
+type porter struct {
+	b    []byte
+	k, j int
+}
+
+// cons reports whether b[i] is a consonant. y is a consonant at the start
+// of a word or after a vowel.
+func (s *porter) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.cons(i-1)
+	}
+	return true
+}
+
+// m measures the number of vowel-consonant sequences in b[0..j]: a word
+// has the form [C](VC)^m[V].
+func (s *porter) m() int {
+	n, i := 0, 0
+	for ; i <= s.j && s.cons(i); i++ {
+	}
+	for i <= s.j {
+		for ; i <= s.j && !s.cons(i); i++ {
+		}
+		if i > s.j {
+			break
+		}
+		n++
+		for ; i <= s.j && s.cons(i); i++ {
+		}
+	}
+	return n
+}
+
+// vowelInStem reports whether b[0..j] contains a vowel.
+func (s *porter) vowelInStem() bool {
+	for i := 0; i <= s.j; i++ {
+		if !s.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doublec reports whether b[i-1..i] is a double consonant.
+func (s *porter) doublec(i int) bool {
+	return i >= 1 && s.b[i] == s.b[i-1] && s.cons(i)
+}
+
+// cvc reports whether b[i-2..i] is consonant-vowel-consonant and the last
+// consonant is not w, x or y, as in "hop" but not "snow". It restores an e
+// in words like "hope" after "hoping" lost its suffix.
+func (s *porter) cvc(i int) bool {
+	if i < 2 || !s.cons(i) || s.cons(i-1) || !s.cons(i-2) {
+		return false
+	}
+	switch s.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports whether b[0..k] ends with suffix, setting j to the end of
+// the remaining stem if so.
+func (s *porter) ends(suffix string) bool {
+	n := len(suffix)
+	if n > s.k+1 || string(s.b[s.k-n+1:s.k+1]) != suffix {
+		return false
+	}
+	s.j = s.k - n
+	return true
+}
+
+// setto replaces b[j+1..k] with r.
+func (s *porter) setto(r string) {
+	s.b = append(s.b[:s.j+1], r...)
+	s.k = s.j + len(r)
+}
+
+// replace applies the first of the suffix, replacement pairs whose suffix
+// matches, replacing it if the remaining stem has a positive measure.
+func (s *porter) replace(rules ...string) {
+	for i := 0; i+1 < len(rules); i += 2 {
+		if s.ends(rules[i]) {
+			if s.m() > 0 {
+				s.setto(rules[i+1])
+			}
+			return
+		}
+	}
+}
+
+// step1ab removes plurals and -ed or -ing: caresses -> caress, ponies ->
+// poni, cats -> cat, agreed -> agree, plastered -> plaster, motoring ->
+// motor, hopping -> hop, filing -> file.
+func (s *porter) step1ab() {
+	if s.b[s.k] == 's' {
+		switch {
+		case s.ends("sses"):
+			s.k -= 2
+		case s.ends("ies"):
+			s.setto("i")
+		case s.b[s.k-1] != 's':
+			s.k--
+		}
+	}
+	if s.ends("eed") {
+		if s.m() > 0 {
+			s.k--
+		}
+		return
+	}
+	if !(s.ends("ed") || s.ends("ing")) || !s.vowelInStem() {
+		return
+	}
+	s.k = s.j
+	switch {
+	case s.ends("at"):
+		s.setto("ate")
+	case s.ends("bl"):
+		s.setto("ble")
+	case s.ends("iz"):
+		s.setto("ize")
+	case s.doublec(s.k):
+		if c := s.b[s.k]; c != 'l' && c != 's' && c != 'z' {
+			s.k--
+		}
+	default:
+		s.j = s.k
+		if s.m() == 1 && s.cvc(s.k) {
+			s.setto("e")
+		}
+	}
+}
+
+// step1c turns a terminal y into i when there is another vowel in the stem.
+func (s *porter) step1c() {
+	if s.ends("y") && s.vowelInStem() {
+		s.b[s.k] = 'i'
+	}
+}
+
+// step2 maps double suffixes to single ones: -ization -> -ize,
+// -ational -> -ate, and so on.
+func (s *porter) step2() {
+	switch s.b[s.k-1] {
+	case 'a':
+		s.replace("ational", "ate", "tional", "tion")
+	case 'c':
+		s.replace("enci", "ence", "anci", "ance")
+	case 'e':
+		s.replace("izer", "ize")
+	case 'l':
+		s.replace("bli", "ble", "alli", "al", "entli", "ent", "eli", "e", "ousli", "ous")
+	case 'o':
+		s.replace("ization", "ize", "ation", "ate", "ator", "ate")
+	case 's':
+		s.replace("alism", "al", "iveness", "ive", "fulness", "ful", "ousness", "ous")
+	case 't':
+		s.replace("aliti", "al", "iviti", "ive", "biliti", "ble")
+	case 'g':
+		s.replace("logi", "log")
+	}
+}
+
+// step3 handles -ic-, -full, -ness and similar suffixes.
+func (s *porter) step3() {
+	switch s.b[s.k] {
+	case 'e':
+		s.replace("icate", "ic", "ative", "", "alize", "al")
+	case 'i':
+		s.replace("iciti", "ic")
+	case 'l':
+		s.replace("ical", "ic", "ful", "")
+	case 's':
+		s.replace("ness", "")
+	}
+}
+
+// step4 removes -ant, -ence and similar suffixes from stems of measure 2 or
+// more.
+func (s *porter) step4() {
+	var suffixes []string
+	switch s.b[s.k-1] {
+	case 'a':
+		suffixes = []string{"al"}
+	case 'c':
+		suffixes = []string{"ance", "ence"}
+	case 'e':
+		suffixes = []string{"er"}
+	case 'i':
+		suffixes = []string{"ic"}
+	case 'l':
+		suffixes = []string{"able", "ible"}
+	case 'n':
+		suffixes = []string{"ant", "ement", "ment", "ent"}
+	case 'o':
+		if s.ends("ion") && s.j >= 0 && (s.b[s.j] == 's' || s.b[s.j] == 't') {
+			break
+		}
+		suffixes = []string{"ou"}
+	case 's':
+		suffixes = []string{"ism"}
+	case 't':
+		suffixes = []string{"ate", "iti"}
+	case 'u':
+		suffixes = []string{"ous"}
+	case 'v':
+		suffixes = []string{"ive"}
+	case 'z':
+		suffixes = []string{"ize"}
+	default:
+		return
+	}
+	matched := suffixes == nil // -sion or -tion
+	for _, suffix := range suffixes {
+		if s.ends(suffix) {
+			matched = true
+			break
+		}
+	}
+	if matched && s.m() > 1 {
+		s.k = s.j
+	}
+}
+
+// step5 removes a final -e and reduces -ll to -l in longer stems.
+func (s *porter) step5() {
+	s.j = s.k
+	if s.b[s.k] == 'e' {
+		if a := s.m(); a > 1 || a == 1 && !s.cvc(s.k-1) {
+			s.k--
+		}
+	}
+	if s.b[s.k] == 'l' && s.doublec(s.k) && s.m() > 1 {
+		s.k--
+	}
+}
@@ -0,0 +1,161 @@
+package index
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	// Pairs from the Porter algorithm's reference vocabulary.
+	tests := []struct {
+		word, want string
+	}{
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"ties", "ti"},
+		{"caress", "caress"},
+		{"cats", "cat"},
+		{"feed", "feed"},
+		{"agreed", "agre"},
+		{"plastered", "plaster"},
+		{"bled", "bled"},
+		{"motoring", "motor"},
+		{"sing", "sing"},
+		{"conflated", "conflat"},
+		{"troubled", "troubl"},
+		{"sized", "size"},
+		{"hopping", "hop"},
+		{"tanned", "tan"},
+		{"falling", "fall"},
+		{"hissing", "hiss"},
+		{"fizzed", "fizz"},
+		{"failing", "fail"},
+		{"filing", "file"},
+		{"happy", "happi"},
+		{"sky", "sky"},
+		{"relational", "relat"},
+		{"conditional", "condit"},
+		{"rational", "ration"},
+		{"valenci", "valenc"},
+		{"hesitanci", "hesit"},
+		{"digitizer", "digit"},
+		{"conformabli", "conform"},
+		{"radicalli", "radic"},
+		{"differentli", "differ"},
+		{"vileli", "vile"},
+		{"analogousli", "analog"},
+		{"vietnamization", "vietnam"},
+		{"predication", "predic"},
+		{"operator", "oper"},
+		{"feudalism", "feudal"},
+		{"decisiveness", "decis"},
+		{"hopefulness", "hope"},
+		{"callousness", "callous"},
+		{"formaliti", "formal"},
+		{"sensitiviti", "sensit"},
+		{"sensibiliti", "sensibl"},
+		{"triplicate", "triplic"},
+		{"formative", "form"},
+		{"formalize", "formal"},
+		{"electriciti", "electr"},
+		{"electrical", "electr"},
+		{"hopeful", "hope"},
+		{"goodness", "good"},
+		{"revival", "reviv"},
+		{"allowance", "allow"},
+		{"inference", "infer"},
+		{"airliner", "airlin"},
+		{"gyroscopic", "gyroscop"},
+		{"adjustable", "adjust"},
+		{"defensible", "defens"},
+		{"irritant", "irrit"},
+		{"replacement", "replac"},
+		{"adjustment", "adjust"},
+		{"dependent", "depend"},
+		{"adoption", "adopt"},
+		{"homologous", "homolog"},
+		{"communism", "commun"},
+		{"activate", "activ"},
+		{"angulariti", "angular"},
+		{"effective", "effect"},
+		{"bowdlerize", "bowdler"},
+		{"probate", "probat"},
+		{"rate", "rate"},
+		{"cease", "ceas"},
+		{"controll", "control"},
+		{"roll", "roll"},
+		{"generalizations", "gener"},
+		{"oscillators", "oscil"},
+
+		// The forms a documentation search should conflate.
+		{"configure", "configur"},
+		{"configuring", "configur"},
+		{"configuration", "configur"},
+
+		// Words the stemmer leaves alone.
+		{"is", "is"},
+		{"base64", "base64"},
+		{"Running", "Running"},
+		{"café", "café"},
+		{"получение", "получение"},
+	}
+	for _, tt := range tests {
+		if got := stem(tt.word); got != tt.want {
+			t.Errorf("stem(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeEnglish(t *testing.T) {
+	a, err := NewAnalyzer(DefaultAnalyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"The tasks are running", "task@1 run@3"},
+		{"Configuring the Connections", "configur@0 connect@2"},
+		{"retryPolicies", "retrypolici@0 retri@0 polici@1"},
+		{"it is what it is", "what@2"},
+	}
+	for _, tt := range tests {
+		if got := tokenTexts(a.tokenize(tt.text)); got != tt.want {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestNewAnalyzer(t *testing.T) {
+	tests := []struct {
+		spec    string
+		filters string // "" if the spec is invalid
+		name    string
+	}{
+		{"english", "lowercase,fold,stop,stem", "english"},
+		{" standard ", "lowercase,fold", "standard"},
+		{"lowercase, fold, stop", "lowercase,fold,stop", "lowercase,fold,stop"},
+		{"lowercase,fold", "lowercase,fold", "standard"},
+		{"lowercase,soundex", "", ""},
+	}
+	for _, tt := range tests {
+		a, err := NewAnalyzer(tt.spec)
+		if tt.filters == "" {
+			if err == nil {
+				t.Errorf("NewAnalyzer(%q) succeeded, want an error", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewAnalyzer(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := a.String(); got != tt.name {
+			t.Errorf("NewAnalyzer(%q).String() = %q, want %q", tt.spec, got, tt.name)
+		}
+		if got := strings.Join(a.Filters(), ","); got != tt.filters {
+			t.Errorf("NewAnalyzer(%q).Filters() = %q, want %q", tt.spec, got, tt.filters)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package index
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// token is a term and its position in the token stream of one field. The
+// parts of an identifier take consecutive positions starting at the
+// identifier's own, so "get user" matches inside getUserById.
+type token struct {
+	text       string
+	pos        int
+	surface    string // lower-cased word before filters, for fuzzy matching
+	start, end int    // byte offsets of the word in the text
+}
+
+// analyzeMode selects how identifiers are emitted.
+type analyzeMode int
+
+const (
+	modeIndex  analyzeMode = iota // whole and split
+	modeQuery                     // whole only
+	modePhrase                    // split only
+)
+
+// splitTokens splits text into words before any filters are applied. Words
+// are runs of letters, digits, combining marks and underscores in any
+// script; combining marks are dropped. Han, Hiragana and Katakana are
+// written without spaces, so runs of those characters are emitted as
+// overlapping bigrams ("東京都" -> "東京", "京都"), or as a single term when
+// one character long.
+//
+// In modeIndex, words that look like code identifiers are emitted whole and
+// as their camelCase and snake_case parts, so getUserById yields
+// "getUserById", "get", "User", "By" and "Id". Dotted paths such as
+// os.path.join are split at the dots.
+func splitTokens(text string, mode analyzeMode) []token {
+	var (
+		tokens   []token
+		word     []rune
+		wordOffs []int // byte offset of each rune of word
+		cjk      []rune
+		cjkOffs  []int
+		pos      int
+	)
+	flushWord := func(end int) {
+		if len(word) > 0 {
+			tokens, pos = appendWord(tokens, word, wordOffs, end, mode, pos)
+			word, wordOffs = word[:0], wordOffs[:0]
+		}
+	}
+	flushCJK := func(end int) {
+		switch len(cjk) {
+		case 0:
+		case 1:
+			tokens = append(tokens, token{text: string(cjk), pos: pos, start: cjkOffs[0], end: end})
+			pos++
+		default:
+			for i := 0; i+1 < len(cjk); i++ {
+				tokens = append(tokens, token{text: string(cjk[i : i+2]), pos: pos, start: cjkOffs[i], end: cjkOffs[i+1] + utf8.RuneLen(cjk[i+1])})
+				pos++
+			}
+		}
+		cjk, cjkOffs = cjk[:0], cjkOffs[:0]
+	}
+	for i, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord(i)
+			cjk = append(cjk, r)
+			cjkOffs = append(cjkOffs, i)
+		case unicode.Is(unicode.Mn, r):
+			// Combining marks from decomposed input (e + U+0301) are
+			// diacritics: drop them, but keep them from splitting words.
+			flushCJK(i)
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_':
+			flushCJK(i)
+			word = append(word, r)
+			wordOffs = append(wordOffs, i)
+		default:
+			flushWord(i)
+			flushCJK(i)
+		}
+	}
+	flushWord(len(text))
+	flushCJK(len(text))
+	return tokens
+}
+
+// appendWord appends the tokens of one word starting at position pos and
+// returns the position following it. offs holds the byte offset of each
+// rune of word and end the offset just past it. Identifiers made of several
+// parts are emitted whole, split, or both depending on mode.
+func appendWord(tokens []token, word []rune, offs []int, end int, mode analyzeMode, pos int) ([]token, int) {
+	parts := splitIdentifier(word)
+	if len(parts) == 0 {
+		return tokens, pos // only underscores
+	}
+	whole := token{text: string(word), pos: pos, start: offs[0], end: end}
+	if len(parts) == 1 && parts[0] == [2]int{0, len(word)} {
+		return append(tokens, whole), pos + 1
+	}
+	if mode != modePhrase {
+		tokens = append(tokens, whole)
+	}
+	if mode == modeQuery {
+		return tokens, pos + 1
+	}
+	for i, p := range parts {
+		last := p[1] - 1
+		tokens = append(tokens, token{text: string(word[p[0]:p[1]]), pos: pos + i, start: offs[p[0]], end: offs[last] + utf8.RuneLen(word[last])})
+	}
+	return tokens, pos + len(parts)
+}
+
+// splitIdentifier splits a word at underscores and camelCase boundaries,
+// returning the rune range of each part: "getUserByID" -> get, User, By,
+// ID; "HTTPServer" -> HTTP, Server; "max_retries" -> max, retries. Digits
+// stay attached ("base64Encode" -> base64, Encode).
+func splitIdentifier(word []rune) [][2]int {
+	var parts [][2]int
+	start := 0
+	emit := func(end int) {
+		if end > start {
+			parts = append(parts, [2]int{start, end})
+		}
+	}
+	for i, r := range word {
+		switch {
+		case r == '_':
+			emit(i)
+			start = i + 1
+		case i > start && unicode.IsUpper(r):
+			prev := word[i-1]
+			nextLower := i+1 < len(word) && unicode.IsLower(word[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				emit(i)
+				start = i
+			}
+		}
+	}
+	emit(len(word))
+	return parts
+}
+
+// isCJK reports whether r belongs to a script written without word spaces.
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r)
+}
@@ -0,0 +1,144 @@
+package index
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// tokenTexts returns the text of each token, with its position after an @.
+func tokenTexts(tokens []token) string {
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		out[i] = t.text + "@" + strconv.Itoa(t.pos)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestSplitTokensUnicode(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Hello, world!", "Hello@0 world@1"},
+		{"Привет мир", "Привет@0 мир@1"},
+		{"λόγος και πράξη", "λόγος@0 και@1 πράξη@2"},
+		{"cafe\u0301 au lait", "cafe@0 au@1 lait@2"}, // combining acute accent
+		{"東京都に行く", "東京@0 京都@1 都に@2 に行@3 行く@4"},       // kanji and hiragana bigrams
+		{"日 本", "日@0 本@1"},                           // single characters
+		{"version 2.0 of テスト", "version@0 2@1 0@2 of@3 テス@4 スト@5"},
+		{"___", ""},
+	}
+	for _, tt := range tests {
+		if got := tokenTexts(splitTokens(tt.text, modeIndex)); got != tt.want {
+			t.Errorf("splitTokens(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSplitTokensOffsets(t *testing.T) {
+	text := "Ünïcode 東京 test"
+	for _, tok := range splitTokens(text, modeIndex) {
+		if got := text[tok.start:tok.end]; got != tok.text {
+			t.Errorf("token %q spans %q", tok.text, got)
+		}
+	}
+}
+
+func TestAnalyzeStandard(t *testing.T) {
+	a, err := NewAnalyzer("standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Ärger im Büro", "arger@0 im@1 buro@2"},
+		{"STRASSE straße", "strasse@0 strasse@1"},
+		{"Ελληνικά", "ελληνικα@0"},
+	}
+	for _, tt := range tests {
+		if got := tokenTexts(a.tokenize(tt.text)); got != tt.want {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSearchFoldsQuery(t *testing.T) {
+	idx := newTestIndex("Le café est ouvert", "Straße und Weg")
+	tests := []struct {
+		query, want string
+	}{
+		{"cafe", "doc1"},
+		{"CAFÉ", "doc1"},
+		{"strasse", "doc2"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(searchIDs(t, idx, tt.query), " "); got != tt.want {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSplitIdentifier(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"getUserByID", "get User By ID"},
+		{"HTTPServer", "HTTP Server"},
+		{"max_retries", "max retries"},
+		{"__init__", "init"},
+		{"base64Encode", "base64 Encode"},
+		{"parseJSON2", "parse JSON2"},
+		{"simple", "simple"},
+		{"XMLHttpRequest", "XML Http Request"},
+	}
+	for _, tt := range tests {
+		word := []rune(tt.word)
+		var parts []string
+		for _, p := range splitIdentifier(word) {
+			parts = append(parts, string(word[p[0]:p[1]]))
+		}
+		if got := strings.Join(parts, " "); got != tt.want {
+			t.Errorf("splitIdentifier(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestSplitTokensIdentifiers(t *testing.T) {
+	tests := []struct {
+		text string
+		mode analyzeMode
+		want string
+	}{
+		{"call getUserById now", modeIndex, "call@0 getUserById@1 get@1 User@2 By@3 Id@4 now@5"},
+		{"call getUserById now", modeQuery, "call@0 getUserById@1 now@2"},
+		{"call getUserById now", modePhrase, "call@0 get@1 User@2 By@3 Id@4 now@5"},
+		{"os.path.join", modeIndex, "os@0 path@1 join@2"},
+		{"max_retries=3", modeIndex, "max_retries@0 max@0 retries@1 3@2"},
+	}
+	for _, tt := range tests {
+		if got := tokenTexts(splitTokens(tt.text, tt.mode)); got != tt.want {
+			t.Errorf("splitTokens(%q, %d) = %q, want %q", tt.text, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestSearchIdentifierParts(t *testing.T) {
+	idx := newTestIndex("Call getUserById to load a user.", "Set max_retries to 3.")
+	tests := []struct {
+		query, want string
+	}{
+		{"getUserById", "doc1"},
+		{"user", "doc1"},
+		{"max_retries", "doc2"},
+		{"retries", "doc2"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(searchIDs(t, idx, tt.query), " "); got != tt.want {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package index
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/deepersensor/documcp/internal"
+)
+
+// VectorFormatVersion is the version of the on-disk vector index format
+// written by Save.
+const VectorFormatVersion = 1
+
+// exactSearchMax is the number of documents up to which Search compares
+// the query with every vector; below it exact search is as fast as the
+// graph and has perfect recall.
+const exactSearchMax = 2000
+
+// Neighbor is a document found by a vector search and its cosine
+// similarity to the query.
+type Neighbor struct {
+	ID    string
+	Score float64
+}
+
+// VectorIndex holds one embedding vector per document and finds the
+// documents closest to a query vector, exactly in small indexes and through
+// an HNSW graph in large ones. Vectors are normalized when added, so
+// similarity is a dot product. All vectors come from one model and have the
+// same length.
+type VectorIndex struct {
+	mu    sync.RWMutex
+	model string
+	dim   int
+	graph *hnsw
+	ids   map[string]int32 // document ID -> live graph node
+}
+
+// NewVectorIndex returns an empty index for vectors from the named model.
+func NewVectorIndex(model string, params HNSWParams) *VectorIndex {
+	return &VectorIndex{model: model, graph: newHNSW(params), ids: make(map[string]int32)}
+}
+
+// Model returns the name of the model the vectors come from.
+func (v *VectorIndex) Model() string {
+	return v.model
+}
+
+// Len returns the number of documents indexed.
+func (v *VectorIndex) Len() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.ids)
+}
+
+// Has reports whether the document has a vector.
+func (v *VectorIndex) Has(id string) bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	_, ok := v.ids[id]
+	return ok
+}
+
+// IDs returns the IDs of the documents indexed, in no particular order.
+func (v *VectorIndex) IDs() []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	ids := make([]string, 0, len(v.ids))
+	for id := range v.ids {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Add sets the vector of a document, replacing any it had. The first vector
+// added fixes the length of all others.
+func (v *VectorIndex) Add(id string, vec []float32) error {
+	unit := normalize(vec)
+	if unit == nil {
+		return errors.New("vector is empty or zero")
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.dim == 0 {
+		v.dim = len(unit)
+	} else if len(unit) != v.dim {
+		return fmt.Errorf("vector has %d dimensions, index has %d", len(unit), v.dim)
+	}
+	if n, ok := v.ids[id]; ok {
+		v.graph.remove(n)
+	}
+	v.ids[id] = v.graph.insert(id, unit)
+	v.compact()
+	return nil
+}
+
+// Remove deletes the vector of a document, if it has one.
+func (v *VectorIndex) Remove(id string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if n, ok := v.ids[id]; ok {
+		v.graph.remove(n)
+		delete(v.ids, id)
+		v.compact()
+	}
+}
+
+// compact rebuilds the graph without deleted nodes once they make up a
+// third of it, as they slow searches down without being found.
+func (v *VectorIndex) compact() {
+	if v.graph.deleted*3 > len(v.graph.nodes) {
+		v.rebuild(v.graph.params)
+	}
+}
+
+// rebuild inserts the live nodes into a new graph with the given
+// parameters, in their original order.
+func (v *VectorIndex) rebuild(params HNSWParams) {
+	old := v.graph
+	v.graph = newHNSW(params)
+	for _, n := range old.nodes {
+		if !n.deleted {
+			v.ids[n.id] = v.graph.insert(n.id, n.vec)
+		}
+	}
+}
+
+// Search returns the k documents most similar to the query vector, most
+// similar first. In indexes larger than exactSearchMax the result is
+// approximate: a few of the true nearest documents may be missed. A k of 0
+// or less returns every document, exactly.
+func (v *VectorIndex) Search(query []float32, k int) ([]Neighbor, error) {
+	q := normalize(query)
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if q == nil || len(v.ids) == 0 {
+		return nil, nil
+	}
+	if len(q) != v.dim {
+		return nil, fmt.Errorf("query vector has %d dimensions, index has %d", len(q), v.dim)
+	}
+	if k > 0 && len(v.ids) > exactSearchMax {
+		found := v.graph.search(q, k)
+		out := make([]Neighbor, len(found))
+		for i, c := range found {
+			out[i] = Neighbor{ID: v.graph.nodes[c.node].id, Score: c.sim}
+		}
+		return out, nil
+	}
+	return v.exactSearch(q, k), nil
+}
+
+// exactSearch compares q with every vector.
+func (v *VectorIndex) exactSearch(q []float32, k int) []Neighbor {
+	out := make([]Neighbor, 0, len(v.ids))
+	for id, n := range v.ids {
+		out = append(out, Neighbor{ID: id, Score: dot(q, v.graph.nodes[n].vec)})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].ID < out[j].ID
+	})
+	if k > 0 && len(out) > k {
+		out = out[:k]
+	}
+	return out
+}
+
+// normalize returns vec scaled to unit length, or nil if it has none.
+func normalize(vec []float32) []float32 {
+	var sum float64
+	for _, x := range vec {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 || math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return nil
+	}
+	norm := math.Sqrt(sum)
+	out := make([]float32, len(vec))
+	for i, x := range vec {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+// dot returns the dot product of two vectors of the same length. It is the
+// inner loop of every search, hence the four independent accumulators.
+func dot(a, b []float32) float64 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return float64(s0 + s1 + s2 + s3)
+}
+
+// vectorFile is the on-disk representation of a VectorIndex. Vectors are
+// stored as base64 little-endian float32s, which is far more compact than
+// JSON numbers.
+type vectorFile struct {
+	FormatVersion int        `json:"format_version"`
+	Model         string     `json:"model"`
+	Dim           int        `json:"dim"`
+	Graph         *graphFile `json:"graph"`
+}
+
+// graphFile is the on-disk representation of an hnsw graph. Links are
+// indexes into Nodes.
+type graphFile struct {
+	M              int        `json:"m"`
+	EfConstruction int        `json:"ef_construction"`
+	Entry          int32      `json:"entry"`
+	MaxLevel       int        `json:"max_level"`
+	Nodes          []nodeFile `json:"nodes"`
+}
+
+type nodeFile struct {
+	ID      string    `json:"id"`
+	Vector  string    `json:"vector"`
+	Links   [][]int32 `json:"links"`
+	Deleted bool      `json:"deleted,omitempty"`
+}
+
+// Save atomically writes the index, graph included, to path.
+func (v *VectorIndex) Save(path string) error {
+	v.mu.RLock()
+	g := v.graph
+	f := vectorFile{
+		FormatVersion: VectorFormatVersion,
+		Model:         v.model,
+		Dim:           v.dim,
+		Graph: &graphFile{
+			M:              g.params.M,
+			EfConstruction: g.params.EfConstruction,
+			Entry:          g.entry,
+			MaxLevel:       g.maxLevel,
+			Nodes:          make([]nodeFile, len(g.nodes)),
+		},
+	}
+	for i, n := range g.nodes {
+		f.Graph.Nodes[i] = nodeFile{ID: n.id, Vector: encodeVector(n.vec), Links: n.links, Deleted: n.deleted}
+	}
+	err := internal.WriteFileAtomic(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(&f)
+	})
+	v.mu.RUnlock()
+	return err
+}
+
+// LoadVectorIndex reads an index written by Save. A missing file, or one
+// holding vectors from a model other than the named one, yields an empty
+// index for that model; its documents need embedding again. A graph built
+// with other M or EfConstruction parameters is rebuilt.
+func LoadVectorIndex(path, model string, params HNSWParams) (*VectorIndex, error) {
+	v := NewVectorIndex(model, params)
+	data, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return v, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	var f vectorFile
+	if err := json.NewDecoder(data).Decode(&f); err != nil {
+		return nil, fmt.Errorf("decode vector index %s: %w", path, err)
+	}
+	if f.FormatVersion != VectorFormatVersion || f.Graph == nil {
+		return nil, fmt.Errorf("vector index %s has unsupported format version %d (want %d)", path, f.FormatVersion, VectorFormatVersion)
+	}
+	if f.Model != model {
+		return v, nil
+	}
+	v.dim = f.Dim
+	g := v.graph
+	g.entry, g.maxLevel = f.Graph.Entry, f.Graph.MaxLevel
+	g.nodes = make([]hnswNode, len(f.Graph.Nodes))
+	for i, n := range f.Graph.Nodes {
+		vec, ok := decodeVector(n.Vector, f.Dim)
+		if !ok {
+			return nil, fmt.Errorf("vector index %s has a malformed vector for %s", path, n.ID)
+		}
+		// A node has links on each layer from 0 up to its level, and may
+		// only link to nodes that reach the layer of the link.
+		if len(n.Links) == 0 || len(n.Links) > f.Graph.MaxLevel+1 {
+			return nil, fmt.Errorf("vector index %s has %d link layers for %s, want 1 to %d", path, len(n.Links), n.ID, f.Graph.MaxLevel+1)
+		}
+		for l, links := range n.Links {
+			for _, nb := range links {
+				if nb < 0 || int(nb) >= len(f.Graph.Nodes) {
+					return nil, fmt.Errorf("vector index %s has a link out of range for %s", path, n.ID)
+				}
+				if len(f.Graph.Nodes[nb].Links) <= l {
+					return nil, fmt.Errorf("vector index %s links %s on layer %d to a node below it", path, n.ID, l)
+				}
+			}
+		}
+		g.nodes[i] = hnswNode{id: n.ID, vec: vec, links: n.Links, deleted: n.Deleted}
+		if n.Deleted {
+			g.deleted++
+		} else {
+			v.ids[n.ID] = int32(i)
+		}
+	}
+	if len(g.nodes) > 0 && (g.entry < 0 || int(g.entry) >= len(g.nodes) || len(g.nodes[g.entry].links) != g.maxLevel+1) {
+		return nil, fmt.Errorf("vector index %s has an invalid entry point", path)
+	}
+	if f.Graph.M != params.M || f.Graph.EfConstruction != params.EfConstruction {
+		v.rebuild(params)
+	}
+	return v, nil
+}
+
+func encodeVector(vec []float32) string {
+	buf := make([]byte, 4*len(vec))
+	for i, x := range vec {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+func decodeVector(s string, dim int) ([]float32, bool) {
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(buf) != 4*dim {
+		return nil, false
+	}
+	vec := make([]float32, dim)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return vec, true
+}
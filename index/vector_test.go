@@ -0,0 +1,53 @@
+package index
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVectorIndexSearch(t *testing.T) {
+	v := NewVectorIndex("test", DefaultHNSWParams)
+	for id, vec := range map[string][]float32{
+		"east":  {1, 0},
+		"north": {0, 2}, // lengths do not matter
+		"ne":    {1, 1},
+	} {
+		if err := v.Add(id, vec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		query []float32
+		k     int
+		want  string // IDs, most similar first
+	}{
+		{[]float32{1, 0.1}, 0, "east ne north"},
+		{[]float32{0.1, 1}, 2, "north ne"},
+		{[]float32{-1, -1}, 1, "east"}, // ties broken by ID
+		{[]float32{0, 0}, 0, ""},
+	}
+	for _, tt := range tests {
+		got, err := v.Search(tt.query, tt.k)
+		if err != nil {
+			t.Errorf("Search(%v, %d): %v", tt.query, tt.k, err)
+			continue
+		}
+		ids := make([]string, len(got))
+		for i, n := range got {
+			ids[i] = n.ID
+		}
+		if s := strings.Join(ids, " "); s != tt.want {
+			t.Errorf("Search(%v, %d) = %q, want %q", tt.query, tt.k, s, tt.want)
+		}
+	}
+
+	if err := v.Add("short", []float32{1}); err == nil {
+		t.Error("Add accepted a vector of another length")
+	}
+	if err := v.Add("zero", []float32{0, 0}); err == nil {
+		t.Error("Add accepted a zero vector")
+	}
+	if _, err := v.Search([]float32{1, 0, 0}, 1); err == nil {
+		t.Error("Search accepted a query of another length")
+	}
+}
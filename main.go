@@ -1,26 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/deepersensor/documcp/api"
+	"github.com/deepersensor/documcp/collection"
 	"github.com/deepersensor/documcp/config"
-	"github.com/deepersensor/documcp/docstore"
+	"github.com/deepersensor/documcp/embed"
 	"github.com/deepersensor/documcp/index"
-	"github.com/deepersensor/documcp/internal"
 	"github.com/deepersensor/documcp/scheduler"
 )
 
 const version = "0.1.0"
 
-// Global in-memory stores for API and CLI
-var (
-	globalDocStore = make(map[string]*docstore.Document)
-	globalIndex    = index.NewInvertedIndex()
-)
-
 func main() {
 	// Load config at startup
 	configDir, err := config.GetDefaultConfigDir()
@@ -33,7 +31,6 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
 		os.Exit(1)
 	}
-	_ = cfg // suppress unused variable warning
 
 	if len(os.Args) < 2 {
 		printUsage()
@@ -47,11 +44,18 @@ func main() {
 		depth := crawlCmd.Int("depth", 2, "Max crawl depth")
 		maxPages := crawlCmd.Int("max", 20, "Max pages to crawl")
 		concurrency := crawlCmd.Int("concurrency", 4, "Number of concurrent workers")
+		collectionName := crawlCmd.String("collection", collection.DefaultName, "Collection to index into")
 		crawlCmd.Parse(os.Args[2:])
 		if *url == "" {
 			fmt.Println("Please provide a seed URL with -url")
 			os.Exit(1)
 		}
+		collections := openCollections(configDir, cfg)
+		c, err := collections.GetOrCreate(*collectionName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open collection: %v\n", err)
+			os.Exit(1)
+		}
 		s := scheduler.NewScheduler(configDir)
 		job, results, err := s.StartCrawlJob(*url, *depth, *maxPages, *concurrency)
 		if err != nil {
@@ -60,44 +64,70 @@ func main() {
 		}
 		fmt.Printf("Crawling: %s (depth=%d, max=%d, concurrency=%d)\n", *url, *depth, *maxPages, *concurrency)
 		fmt.Printf("Process ID: %s\nProcess Dir: %s\n", job.ProcessID, job.ProcessDir)
-		// Indexing and docstore population
-		for _, res := range results {
-			// Parse sentences, code, headings
-			sentences := internal.SplitTextToSentences(res.Text)
-			// For code/headings, parse HTML again (not optimal, but works for now)
-			doc, _ := internal.ParseHTMLFromURL(res.URL)
-			var codeSnippets, headings []string
-			if doc != nil {
-				codeSnippets = internal.ExtractCodeSnippets(doc)
-				headings = internal.ExtractHeadings(doc)
-			}
-			docID := globalIndex.AddDocument(res.URL, "", res.Text)
-			d := docstore.NewDocument(docID, res.URL, "", res.Text, headings, codeSnippets, nil, 1)
-			globalDocStore[docID] = d
-			// Optionally, index sentences and code snippets as well
-			for _, s := range sentences {
-				globalIndex.AddDocument(res.URL, "", s)
-			}
-			for _, code := range codeSnippets {
-				globalIndex.AddDocument(res.URL, "", code)
-			}
+		c.AddResults(results)
+		if _, err := c.Embed(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to compute vectors, the next crawl will retry: %v\n", err)
 		}
-		fmt.Printf("Indexed %d documents.\n", len(results))
+		if err := c.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save index: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Indexed %d documents into collection %q.\n", len(results), c.Name)
 		fmt.Printf("Results saved to: %s\n", job.ProcessDir)
 	case "query":
 		queryCmd := flag.NewFlagSet("query", flag.ExitOnError)
 		queryStr := queryCmd.String("s", "", "Query string")
+		collectionName := queryCmd.String("collection", collection.DefaultName, "Collection to search")
+		pre := queryCmd.String("pre", index.DefaultHighlightPre, "Marker before each matched word in snippets")
+		post := queryCmd.String("post", index.DefaultHighlightPost, "Marker after each matched word in snippets")
+		snippetLength := queryCmd.Int("snippet-length", index.DefaultSnippetLength, "Approximate snippet length in bytes")
+		full := queryCmd.Bool("full", false, "Print each result's full text instead of a snippet")
+		limit := queryCmd.Int("limit", collection.DefaultLimit, "Maximum number of results to print (0 for all)")
+		offset := queryCmd.Int("offset", 0, "Number of results to skip")
+		sortBy := queryCmd.String("sort", collection.SortRelevance, "Result order: relevance, url or title")
+		mode := queryCmd.String("mode", collection.ModeLexical, "Search mode: lexical, vector or hybrid")
 		queryCmd.Parse(os.Args[2:])
 		if *queryStr == "" {
 			fmt.Println("Please provide a query string with -s")
 			os.Exit(1)
 		}
-		results := globalIndex.Search(*queryStr)
-		fmt.Printf("Found %d results for query: %q\n", len(results), *queryStr)
-		for _, doc := range results {
-			d := globalDocStore[doc.ID]
+		collections := openCollections(configDir, cfg)
+		c, err := collections.Get(*collectionName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open collection: %v\n", err)
+			os.Exit(1)
+		}
+		hits, total, err := c.Search(context.Background(), *queryStr, collection.SearchOptions{Offset: *offset, Limit: *limit, Sort: *sortBy, Mode: *mode})
+		var syntaxErr *index.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			fmt.Fprintf(os.Stderr, "Invalid query: %s\n  %s\n  %*s^\n", syntaxErr.Msg, syntaxErr.Query, syntaxErr.Column()-1, "")
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Search failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Found %d results for query: %q\n", total, *queryStr)
+		if len(hits) > 0 && len(hits) < total {
+			fmt.Printf("Showing %d-%d\n", *offset+1, *offset+len(hits))
+		}
+		for _, s := range c.Suggest(*queryStr, total) {
+			fmt.Printf("Did you mean: %s\n", s)
+		}
+		hl := c.Index.Highlighter(*queryStr, index.SnippetOptions{Length: *snippetLength, Pre: *pre, Post: *post})
+		for _, h := range hits {
+			d := h.Doc
 			fmt.Printf("URL: %s\n", d.URL)
-			fmt.Printf("Text: %.200s\n", d.Text)
+			fmt.Printf("Score: %.3f\n", h.Score)
+			passage := d.Text
+			if sec := h.Section; sec != nil {
+				fmt.Printf("Section: %s (%s)\n", strings.Join(sec.Path, " > "), sec.URL)
+				passage = sec.Text
+			}
+			if *full {
+				fmt.Printf("Text: %s\n", d.Text)
+			} else {
+				fmt.Printf("Snippet: %s\n", hl.Snippet(passage))
+			}
 			if len(d.Headings) > 0 {
 				fmt.Printf("Headings: %v\n", d.Headings)
 			}
@@ -109,14 +139,70 @@ func main() {
 	case "serve":
 		serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
 		port := serveCmd.String("port", "8080", "Port to run API server on")
+		collectionName := serveCmd.String("collection", collection.DefaultName, "Default collection for requests")
 		serveCmd.Parse(os.Args[2:])
+		if err := collection.ValidateName(*collectionName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 		fmt.Printf("Starting API server on port %s\n", *port)
-		// Pass references to globalDocStore and globalIndex to the API
-		api.SetGlobalStores(globalDocStore, globalIndex)
+		api.SetCollections(openCollections(configDir, cfg), *collectionName)
+		api.SetScheduler(scheduler.NewScheduler(configDir))
+		api.SetAllowedOrigins(cfg.AllowedOrigins)
 		if err := api.StartServer(":" + *port); err != nil {
 			fmt.Fprintf(os.Stderr, "API server failed: %v\n", err)
 			os.Exit(1)
 		}
+	case "mcp":
+		mcpCmd := flag.NewFlagSet("mcp", flag.ExitOnError)
+		collectionName := mcpCmd.String("collection", collection.DefaultName, "Default collection for requests")
+		mcpCmd.Parse(os.Args[2:])
+		if err := collection.ValidateName(*collectionName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// MCP speaks JSON-RPC on stdout, so nothing else may be printed there.
+		api.SetCollections(openCollections(configDir, cfg), *collectionName)
+		api.SetScheduler(scheduler.NewScheduler(configDir))
+		if err := api.ServeStdio(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "MCP server failed: %v\n", err)
+			os.Exit(1)
+		}
+	case "remove":
+		removeCmd := flag.NewFlagSet("remove", flag.ExitOnError)
+		id := removeCmd.String("id", "", "ID of the page to remove")
+		pageURL := removeCmd.String("url", "", "URL of the page to remove")
+		collectionName := removeCmd.String("collection", collection.DefaultName, "Collection to remove from")
+		removeCmd.Parse(os.Args[2:])
+		if (*id == "") == (*pageURL == "") {
+			fmt.Println("Please provide either -id or -url")
+			os.Exit(1)
+		}
+		collections := openCollections(configDir, cfg)
+		c, err := collections.Get(*collectionName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open collection: %v\n", err)
+			os.Exit(1)
+		}
+		removed := 0
+		if *id != "" {
+			if c.RemovePage(*id) {
+				removed = 1
+			}
+		} else {
+			removed = c.RemoveURL(*pageURL)
+		}
+		if removed == 0 {
+			fmt.Fprintln(os.Stderr, "No such page")
+			os.Exit(1)
+		}
+		if err := c.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save index: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed %d page(s) from collection %q.\n", removed, c.Name)
+	case "collections":
+		runCollections(openCollections(configDir, cfg), os.Args[2:])
 	case "config":
 		configCmd := flag.NewFlagSet("config", flag.ExitOnError)
 		dir := configCmd.String("dir", "", "Config directory to use")
@@ -140,6 +226,23 @@ func main() {
 		fmt.Printf("Config loaded from %s:\n", configDir)
 		fmt.Printf("  AppName: %s\n", cfg.AppName)
 		fmt.Printf("  Version: %s\n", cfg.Version)
+		fmt.Printf("  BM25: k1=%g b=%g\n", cfg.BM25K1, cfg.BM25B)
+		fields := make([]string, 0, len(cfg.FieldBoosts))
+		for field := range cfg.FieldBoosts {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			fmt.Printf("  Boost %s: %g\n", field, cfg.FieldBoosts[field])
+		}
+		fmt.Printf("  Analyzer: %s\n", cfg.Analyzer)
+		fmt.Printf("  Embedder: %s\n", cfg.Embedder)
+		if cfg.Embedder == "openai" {
+			fmt.Printf("  Embedding URL: %s\n", cfg.EmbeddingURL)
+			fmt.Printf("  Embedding model: %s\n", cfg.EmbeddingModel)
+		}
+		fmt.Printf("  HNSW: m=%d ef_construction=%d ef_search=%d\n", cfg.HNSWM, cfg.HNSWEfConstruction, cfg.HNSWEfSearch)
+		fmt.Printf("  Allowed origins: %s\n", strings.Join(append([]string{"loopback"}, cfg.AllowedOrigins...), ", "))
 	case "version":
 		fmt.Println("documcp version", version)
 	default:
@@ -148,12 +251,120 @@ func main() {
 	}
 }
 
+// openCollections returns the manager of the collections in configDir,
+// exiting if the configured ranking, analyzer, embedder or HNSW parameters
+// are invalid.
+func openCollections(configDir string, cfg *config.Config) *collection.Manager {
+	ranking := index.Ranking{K1: cfg.BM25K1, B: cfg.BM25B, Boosts: cfg.FieldBoosts}
+	if err := ranking.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid ranking config: %v\n", err)
+		os.Exit(1)
+	}
+	analyzer, err := index.NewAnalyzer(cfg.Analyzer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid analyzer config: %v\n", err)
+		os.Exit(1)
+	}
+	embedder, err := embed.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid embedder config: %v\n", err)
+		os.Exit(1)
+	}
+	hnsw := index.HNSWParams{M: cfg.HNSWM, EfConstruction: cfg.HNSWEfConstruction, EfSearch: cfg.HNSWEfSearch}
+	if err := hnsw.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid hnsw config: %v\n", err)
+		os.Exit(1)
+	}
+	return collection.NewManager(config.GetIndexesDir(configDir), ranking, analyzer, embedder, hnsw)
+}
+
 func printUsage() {
 	fmt.Println("Usage: documcp <command> [options]")
 	fmt.Println("Commands:")
 	fmt.Println("  crawl   -url <seed_url>    Crawl a documentation site")
 	fmt.Println("  query   -s <string>        Query indexed content")
+	fmt.Println("  remove  -id <id>|-url <url>")
+	fmt.Println("                             Remove a page and its sections")
 	fmt.Println("  serve   [-port <port>]     Start the API server")
+	fmt.Println("  mcp                        Run an MCP server over stdio")
+	fmt.Println("  collections list|rm|rename|analyzer")
+	fmt.Println("                             Manage named collections")
 	fmt.Println("  config  [-dir <dir>]       Show config from specified directory")
 	fmt.Println("  version                     Show version")
+	fmt.Println("crawl, query, remove, serve and mcp accept -collection <name> (default \"default\").")
+}
+
+// runCollections implements the collections subcommands.
+func runCollections(collections *collection.Manager, args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: documcp collections list | rm <name> | rename <old> <new> | analyzer <name> [<analyzer>]")
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "list":
+		names, err := collections.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list collections: %v\n", err)
+			os.Exit(1)
+		}
+		for _, name := range names {
+			c, err := collections.Get(name)
+			if err != nil {
+				fmt.Printf("%-24s (error: %v)\n", name, err)
+				continue
+			}
+			fmt.Printf("%-24s %6d pages  analyzer %s\n", name, len(c.Docs.Pages()), c.Index.Analyzer())
+		}
+	case "rm":
+		if len(args) != 2 {
+			fmt.Println("Usage: documcp collections rm <name>")
+			os.Exit(1)
+		}
+		if err := collections.Remove(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove collection: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed collection %q\n", args[1])
+	case "rename":
+		if len(args) != 3 {
+			fmt.Println("Usage: documcp collections rename <old> <new>")
+			os.Exit(1)
+		}
+		if err := collections.Rename(args[1], args[2]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rename collection: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Renamed collection %q to %q\n", args[1], args[2])
+	case "analyzer":
+		if len(args) != 2 && len(args) != 3 {
+			fmt.Println("Usage: documcp collections analyzer <name> [<analyzer>]")
+			os.Exit(1)
+		}
+		c, err := collections.Get(args[1])
+		if errors.Is(err, collection.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "No collection named %q\n", args[1])
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open collection: %v\n", err)
+			os.Exit(1)
+		}
+		if len(args) == 2 {
+			fmt.Println(c.Index.Analyzer())
+			return
+		}
+		a, err := index.NewAnalyzer(args[2])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		c.Index.SetAnalyzer(a)
+		if err := c.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save index: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Collection %q now uses analyzer %s\n", c.Name, a)
+	default:
+		fmt.Println("Usage: documcp collections list | rm <name> | rename <old> <new> | analyzer <name> [<analyzer>]")
+		os.Exit(1)
+	}
 }
@@ -1,12 +1,34 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
 	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/deepersensor/documcp/config"
 	"github.com/deepersensor/documcp/crawler"
 )
 
+// JobState is the lifecycle state of a crawl job.
+type JobState string
+
+const (
+	JobRunning   JobState = "running"
+	JobCompleted JobState = "completed"
+	JobCancelled JobState = "cancelled"
+	JobFailed    JobState = "failed"
+)
+
+// Finished jobs are forgotten once they are older than finishedJobTTL, or
+// when more than maxFinishedJobs have finished, oldest first.
+const (
+	finishedJobTTL  = time.Hour
+	maxFinishedJobs = 100
+)
+
 // CrawlJob represents a crawl job request.
 type CrawlJob struct {
 	SeedURL     string
@@ -15,37 +37,228 @@ type CrawlJob struct {
 	Concurrency int
 	ProcessID   string
 	ProcessDir  string
+	StartedAt   time.Time
+
+	mu         sync.Mutex
+	state      JobState
+	pages      int
+	lastURL    string
+	finishedAt time.Time
+	err        error
+	results    []crawler.CrawlResult
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// JobStatus is a point-in-time snapshot of a crawl job.
+type JobStatus struct {
+	ProcessID  string     `json:"job_id"`
+	SeedURL    string     `json:"seed_url"`
+	State      JobState   `json:"state"`
+	Pages      int        `json:"pages"`
+	MaxPages   int        `json:"max_pages"`
+	LastURL    string     `json:"last_url,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Status returns a snapshot of the job's progress.
+func (j *CrawlJob) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st := JobStatus{
+		ProcessID: j.ProcessID,
+		SeedURL:   j.SeedURL,
+		State:     j.state,
+		Pages:     j.pages,
+		MaxPages:  j.MaxPages,
+		LastURL:   j.lastURL,
+		StartedAt: j.StartedAt,
+	}
+	if !j.finishedAt.IsZero() {
+		t := j.finishedAt
+		st.FinishedAt = &t
+	}
+	if j.err != nil {
+		st.Error = j.err.Error()
+	}
+	return st
+}
+
+// Cancel stops the crawl. Pages fetched so far are kept.
+func (j *CrawlJob) Cancel() {
+	j.cancel()
+}
+
+// Done returns a channel that is closed when the job has finished.
+func (j *CrawlJob) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait blocks until the job has finished and returns its results. Jobs with
+// an OnFinish callback hand their results to it instead and return none.
+func (j *CrawlJob) Wait() ([]crawler.CrawlResult, error) {
+	<-j.done
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.results, j.err
+}
+
+// CrawlOptions configures a crawl job.
+type CrawlOptions struct {
+	MaxDepth    int
+	MaxPages    int
+	Concurrency int
+	// OnPage is called for every page fetched. It must not block.
+	OnPage func(job *CrawlJob, res crawler.CrawlResult)
+	// OnFinish runs once the crawl stops and before the job is marked done,
+	// e.g. to index the results. Its error fails the job. The job does not
+	// keep results passed to OnFinish.
+	OnFinish func(job *CrawlJob, results []crawler.CrawlResult) error
 }
 
 // Scheduler manages crawl jobs and process directories.
 type Scheduler struct {
 	ConfigDir string
+
+	mu   sync.Mutex
+	jobs map[string]*CrawlJob
 }
 
 // NewScheduler creates a new Scheduler.
 func NewScheduler(configDir string) *Scheduler {
-	return &Scheduler{ConfigDir: configDir}
+	return &Scheduler{ConfigDir: configDir, jobs: make(map[string]*CrawlJob)}
 }
 
 // StartCrawlJob creates a process dir, starts a crawl, and returns the job info and results.
 func (s *Scheduler) StartCrawlJob(seedURL string, maxDepth, maxPages, concurrency int) (*CrawlJob, []crawler.CrawlResult, error) {
+	job, err := s.Submit(seedURL, CrawlOptions{
+		MaxDepth:    maxDepth,
+		MaxPages:    maxPages,
+		Concurrency: concurrency,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	results, err := job.Wait()
+	return job, results, err
+}
+
+// Submit creates a process dir and starts a crawl in the background.
+func (s *Scheduler) Submit(seedURL string, opts CrawlOptions) (*CrawlJob, error) {
 	processesDir := config.GetProcessesDir(s.ConfigDir)
 	processDir, err := crawler.NewProcessDir(processesDir)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	c, err := crawler.NewCrawler(seedURL, processDir)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	results, err := c.Start(seedURL, maxDepth, maxPages, concurrency)
+	ctx, cancel := context.WithCancel(context.Background())
 	job := &CrawlJob{
 		SeedURL:     seedURL,
-		MaxDepth:    maxDepth,
-		MaxPages:    maxPages,
-		Concurrency: concurrency,
+		MaxDepth:    opts.MaxDepth,
+		MaxPages:    opts.MaxPages,
+		Concurrency: opts.Concurrency,
 		ProcessID:   filepath.Base(processDir),
 		ProcessDir:  processDir,
+		StartedAt:   time.Now(),
+		state:       JobRunning,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+	c.OnResult = func(res crawler.CrawlResult, pages int) {
+		job.mu.Lock()
+		job.pages = pages
+		job.lastURL = res.URL
+		job.mu.Unlock()
+		if opts.OnPage != nil {
+			opts.OnPage(job, res)
+		}
+	}
+
+	s.mu.Lock()
+	s.evict(time.Now())
+	s.jobs[job.ProcessID] = job
+	s.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		results, err := c.Start(ctx, seedURL, opts.MaxDepth, opts.MaxPages, opts.Concurrency)
+		if opts.OnFinish != nil {
+			if ferr := opts.OnFinish(job, results); ferr != nil && err == nil {
+				err = ferr
+			}
+		}
+		job.mu.Lock()
+		if opts.OnFinish == nil {
+			job.results = results
+		}
+		job.finishedAt = time.Now()
+		switch {
+		case errors.Is(err, context.Canceled):
+			job.state = JobCancelled
+		case err != nil:
+			job.state = JobFailed
+			job.err = err
+		default:
+			job.state = JobCompleted
+		}
+		job.mu.Unlock()
+		close(job.done)
+	}()
+	return job, nil
+}
+
+// Job returns the job with the given process ID.
+func (s *Scheduler) Job(id string) (*CrawlJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict(time.Now())
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+// Jobs returns all jobs started by this scheduler, oldest first.
+func (s *Scheduler) Jobs() []*CrawlJob {
+	s.mu.Lock()
+	s.evict(time.Now())
+	jobs := make([]*CrawlJob, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.Before(jobs[j].StartedAt) })
+	return jobs
+}
+
+// evict forgets finished jobs that are too old or too many. The caller
+// holds s.mu.
+func (s *Scheduler) evict(now time.Time) {
+	type finished struct {
+		id string
+		at time.Time
+	}
+	var kept []finished
+	for id, j := range s.jobs {
+		j.mu.Lock()
+		at := j.finishedAt
+		j.mu.Unlock()
+		switch {
+		case at.IsZero():
+		case now.Sub(at) > finishedJobTTL:
+			delete(s.jobs, id)
+		default:
+			kept = append(kept, finished{id, at})
+		}
+	}
+	if len(kept) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].at.Before(kept[j].at) })
+	for _, f := range kept[:len(kept)-maxFinishedJobs] {
+		delete(s.jobs, f.id)
 	}
-	return job, results, err
 }
@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/deepersensor/documcp/crawler"
+)
+
+func TestEvict(t *testing.T) {
+	now := time.Now()
+	s := NewScheduler(t.TempDir())
+	add := func(id string, finishedAgo time.Duration) {
+		j := &CrawlJob{ProcessID: id, state: JobCompleted}
+		if finishedAgo >= 0 {
+			j.finishedAt = now.Add(-finishedAgo)
+		} else {
+			j.state = JobRunning
+		}
+		s.jobs[id] = j
+	}
+	add("running", -1)
+	add("recent", time.Second)
+	add("expired", finishedJobTTL+time.Minute)
+	for i := range maxFinishedJobs {
+		add(fmt.Sprintf("job%03d", i), time.Duration(i+2)*time.Second)
+	}
+
+	s.evict(now)
+	tests := []struct {
+		id   string
+		kept bool
+	}{
+		{"running", true},
+		{"recent", true},
+		{"expired", false},
+		{"job000", true},
+		{fmt.Sprintf("job%03d", maxFinishedJobs-2), true},
+		{fmt.Sprintf("job%03d", maxFinishedJobs-1), false}, // the oldest beyond the cap
+	}
+	for _, tt := range tests {
+		if _, ok := s.jobs[tt.id]; ok != tt.kept {
+			t.Errorf("job %s kept = %v, want %v", tt.id, ok, tt.kept)
+		}
+	}
+	if n := len(s.jobs); n != maxFinishedJobs+1 {
+		t.Errorf("%d jobs left, want %d finished and the running one", n, maxFinishedJobs)
+	}
+}
+
+func TestOnFinishResultsNotKept(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><head><title>Home</title></head><body><p>Hello</p></body></html>")
+	}))
+	defer srv.Close()
+	s := NewScheduler(t.TempDir())
+
+	tests := []struct {
+		name     string
+		onFinish bool
+		want     int
+	}{
+		{"without OnFinish", false, 1},
+		{"with OnFinish", true, 0},
+	}
+	for _, tt := range tests {
+		var finished int
+		opts := CrawlOptions{MaxPages: 1, Concurrency: 1}
+		if tt.onFinish {
+			opts.OnFinish = func(job *CrawlJob, results []crawler.CrawlResult) error {
+				finished = len(results)
+				return nil
+			}
+		}
+		job, err := s.Submit(srv.URL, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := job.Wait()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(results) != tt.want {
+			t.Errorf("%s: Wait returned %d results, want %d", tt.name, len(results), tt.want)
+		}
+		if tt.onFinish && finished != 1 {
+			t.Errorf("%s: OnFinish got %d results, want 1", tt.name, finished)
+		}
+	}
+}